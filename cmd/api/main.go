@@ -1,9 +1,15 @@
 package main
 
 import (
+	logger "gin-project/internal/log"
 	svr "gin-project/internal/server"
+	"os"
 )
 
 func main() {
-	svr.FatalLog.PrintFatal(svr.NewServer(), nil)
+	err := svr.NewServer()
+	if err != nil {
+		// the server logger is closed by now, the error goes to stderr
+		logger.New(os.Stderr, logger.LevelInfo).Fatal(err)
+	}
 }
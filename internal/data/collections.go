@@ -0,0 +1,463 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"gin-project/internal/database"
+	"gin-project/internal/validator"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnknownMovies = errors.New("unknown movies")
+	ErrInvalidOrder  = errors.New("invalid order")
+)
+
+// Collection is an ordered list of movies owned by a user, the watchlist is the
+// collection flagged as such and is created on first use
+type Collection struct {
+	ID          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	UserID      uuid.UUID `json:"user_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Public      bool      `json:"public"`
+	Watchlist   bool      `json:"watchlist"`
+	ItemCount   int       `json:"item_count"`
+	Version     int32     `json:"version"`
+}
+
+// CollectionItem is a movie in a collection with its position
+type CollectionItem struct {
+	Position int32     `json:"position"`
+	AddedAt  time.Time `json:"added_at"`
+	Movie    *Movie    `json:"movie"`
+}
+
+// CollectionModel define a model db for collections and their items
+type CollectionModel struct {
+	service database.Service
+}
+
+// collectionItemCount count the items of the collection, the movies in the
+// trash are left out as they are not listed with the items
+const collectionItemCount = `(SELECT count(*) FROM collection_items
+		INNER JOIN movies ON movies.id = collection_items.movie_id
+		WHERE collection_items.collection_id = collections.id AND movies.deleted_at IS NULL)`
+
+const collectionColumns = `id, created_at, updated_at, user_id, name, description, public, watchlist,
+	` + collectionItemCount + `, version`
+
+func scanCollection(row interface{ Scan(...any) error }, collection *Collection) error {
+	return row.Scan(
+		&collection.ID,
+		&collection.CreatedAt,
+		&collection.UpdatedAt,
+		&collection.UserID,
+		&collection.Name,
+		&collection.Description,
+		&collection.Public,
+		&collection.Watchlist,
+		&collection.ItemCount,
+		&collection.Version,
+	)
+}
+
+func (m *CollectionModel) Insert(ctx context.Context, collection *Collection) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	query := `INSERT INTO collections (user_id, name, description, public)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, created_at, updated_at, version`
+
+	args := []interface{}{collection.UserID, collection.Name, collection.Description, collection.Public}
+	return m.service.DB().QueryRowContext(ctx, query, args...).Scan(&collection.ID, &collection.CreatedAt, &collection.UpdatedAt, &collection.Version)
+}
+
+func (m *CollectionModel) Get(ctx context.Context, id uuid.UUID) (*Collection, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + collectionColumns + `
+	FROM collections
+	WHERE id = $1`
+
+	var collection Collection
+	err := scanCollection(m.service.DB().QueryRowContext(ctx, query, id), &collection)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &collection, nil
+}
+
+// GetWatchlist return the watchlist of the user, creating it on first use
+func (m *CollectionModel) GetWatchlist(ctx context.Context, userID uuid.UUID) (*Collection, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + collectionColumns + `
+	FROM collections
+	WHERE user_id = $1 AND watchlist`
+
+	var collection Collection
+	err := scanCollection(m.service.DB().QueryRowContext(ctx, query, userID), &collection)
+	switch {
+	case err == nil:
+		return &collection, nil
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, err
+	}
+
+	// the watchlist is created on first use, a concurrent request may create
+	// it first in which case the insert does nothing
+	insert := `INSERT INTO collections (user_id, name, watchlist)
+	VALUES ($1, 'Watchlist', true)
+	ON CONFLICT (user_id) WHERE watchlist DO NOTHING`
+	_, err = m.service.DB().ExecContext(ctx, insert, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = scanCollection(m.service.DB().QueryRowContext(ctx, query, userID), &collection)
+	if err != nil {
+		return nil, err
+	}
+	return &collection, nil
+}
+
+// ListVisible return the collections of the user along with the public
+// collections of other users unless onlyOwned is set
+func (m *CollectionModel) ListVisible(ctx context.Context, userID uuid.UUID, onlyOwned bool, filters Filters) ([]*Collection, Metadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var orderBy []string
+	for _, field := range filters.sortFields() {
+		orderBy = append(orderBy, sortColumn(field)+" "+sortDirection(field))
+	}
+
+	query := fmt.Sprintf(`SELECT count(*) OVER(), `+collectionColumns+`
+	FROM collections
+	WHERE user_id = $1 OR (public AND NOT $2)
+	ORDER BY %s, id ASC
+	LIMIT $3 OFFSET $4`, strings.Join(orderBy, ", "))
+
+	rows, err := m.service.DB().QueryContext(ctx, query, userID, onlyOwned, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	collections := []*Collection{}
+	for rows.Next() {
+		var collection Collection
+		err = rows.Scan(
+			&totalRecords,
+			&collection.ID,
+			&collection.CreatedAt,
+			&collection.UpdatedAt,
+			&collection.UserID,
+			&collection.Name,
+			&collection.Description,
+			&collection.Public,
+			&collection.Watchlist,
+			&collection.ItemCount,
+			&collection.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		collections = append(collections, &collection)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return collections, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (m *CollectionModel) Update(ctx context.Context, collection *Collection) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	query := `UPDATE collections
+	SET name = $1, description = $2, public = $3, updated_at = NOW(), version = version + 1
+	WHERE id = $4 AND version = $5
+	RETURNING updated_at, version`
+
+	args := []interface{}{collection.Name, collection.Description, collection.Public, collection.ID, collection.Version}
+	err := m.service.DB().QueryRowContext(ctx, query, args...).Scan(&collection.UpdatedAt, &collection.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *CollectionModel) Delete(ctx context.Context, id uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := m.service.DB().ExecContext(ctx, `DELETE FROM collections WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetItems return the movies of the collection in order
+func (m *CollectionModel) GetItems(ctx context.Context, collectionID uuid.UUID) ([]*CollectionItem, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	query := `SELECT collection_items.position, collection_items.added_at,
+		movies.id, movies.created_at, movies.title, movies.year, movies.runtime, movies.genres, movies.version
+	FROM collection_items
+	INNER JOIN movies ON movies.id = collection_items.movie_id
+	WHERE collection_items.collection_id = $1 AND movies.deleted_at IS NULL
+	ORDER BY collection_items.position, collection_items.added_at`
+
+	rows, err := m.service.DB().QueryContext(ctx, query, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*CollectionItem{}
+	for rows.Next() {
+		item := CollectionItem{Movie: &Movie{}}
+		err = rows.Scan(
+			&item.Position,
+			&item.AddedAt,
+			&item.Movie.ID,
+			&item.Movie.CreatedAt,
+			&item.Movie.Title,
+			&item.Movie.Year,
+			&item.Movie.Runtime,
+			pq.Array(&item.Movie.Genres),
+			&item.Movie.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, &item)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// AddItems append the movies at the end of the collection in the given order,
+// movies already in the collection keep their position
+func (m *CollectionModel) AddItems(ctx context.Context, collection *Collection, movieIDs []uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	tx, err := m.service.DB().BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockCollection(ctx, tx, collection.ID)
+	if err != nil {
+		return err
+	}
+
+	ids := uuidStrings(movieIDs)
+
+	var found int
+	err = tx.QueryRowContext(ctx, `SELECT count(*) FROM movies WHERE id = ANY($1::uuid[]) AND deleted_at IS NULL`, pq.Array(ids)).Scan(&found)
+	if err != nil {
+		return err
+	}
+	if found != len(ids) {
+		return ErrUnknownMovies
+	}
+
+	query := `INSERT INTO collection_items (collection_id, movie_id, position)
+	SELECT $1, new_items.movie_id,
+		(SELECT COALESCE(max(position), 0) FROM collection_items WHERE collection_id = $1) + new_items.ordinality
+	FROM unnest($2::uuid[]) WITH ORDINALITY AS new_items(movie_id, ordinality)
+	ON CONFLICT (collection_id, movie_id) DO NOTHING`
+
+	_, err = tx.ExecContext(ctx, query, collection.ID, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	err = touchCollection(ctx, tx, collection)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RemoveItems remove the movies from the collection, unknown movies are ignored
+func (m *CollectionModel) RemoveItems(ctx context.Context, collection *Collection, movieIDs []uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	tx, err := m.service.DB().BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockCollection(ctx, tx, collection.ID)
+	if err != nil {
+		return err
+	}
+
+	query := `DELETE FROM collection_items
+	WHERE collection_id = $1 AND movie_id = ANY($2::uuid[])`
+
+	_, err = tx.ExecContext(ctx, query, collection.ID, pq.Array(uuidStrings(movieIDs)))
+	if err != nil {
+		return err
+	}
+
+	err = touchCollection(ctx, tx, collection)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Reorder set the position of every item, movieIDs must list each movie of the
+// collection exactly once
+func (m *CollectionModel) Reorder(ctx context.Context, collection *Collection, movieIDs []uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	tx, err := m.service.DB().BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// the collection lock keeps items from being added or removed while the new
+	// order is checked, the movies in the trash are not listed and keep their
+	// position
+	err = lockCollection(ctx, tx, collection.ID)
+	if err != nil {
+		return err
+	}
+
+	query := `SELECT collection_items.movie_id
+	FROM collection_items
+	INNER JOIN movies ON movies.id = collection_items.movie_id
+	WHERE collection_items.collection_id = $1 AND movies.deleted_at IS NULL`
+	rows, err := tx.QueryContext(ctx, query, collection.ID)
+	if err != nil {
+		return err
+	}
+	var current []string
+	for rows.Next() {
+		var id string
+		err = rows.Scan(&id)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		current = append(current, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	ids := uuidStrings(movieIDs)
+	sortedIDs := slices.Clone(ids)
+	slices.Sort(current)
+	slices.Sort(sortedIDs)
+	if !slices.Equal(current, sortedIDs) {
+		return ErrInvalidOrder
+	}
+
+	query = `UPDATE collection_items
+	SET position = new_order.ordinality
+	FROM unnest($2::uuid[]) WITH ORDINALITY AS new_order(movie_id, ordinality)
+	WHERE collection_items.collection_id = $1 AND collection_items.movie_id = new_order.movie_id`
+
+	_, err = tx.ExecContext(ctx, query, collection.ID, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	err = touchCollection(ctx, tx, collection)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// lockCollection lock the collection row until the end of the transaction, every
+// change to the items takes it first so that they are serialized
+func lockCollection(ctx context.Context, tx *sql.Tx, collectionID uuid.UUID) error {
+	var id uuid.UUID
+	err := tx.QueryRowContext(ctx, `SELECT id FROM collections WHERE id = $1 FOR UPDATE`, collectionID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrRecordNotFound
+	}
+	return err
+}
+
+// touchCollection bump the version of the collection after a change to its
+// items, so that its ETag changes along with them, and refresh its count
+func touchCollection(ctx context.Context, tx *sql.Tx, collection *Collection) error {
+	query := `UPDATE collections
+	SET updated_at = NOW(), version = version + 1
+	WHERE id = $1
+	RETURNING updated_at, version, ` + collectionItemCount
+
+	return tx.QueryRowContext(ctx, query, collection.ID).Scan(&collection.UpdatedAt, &collection.Version, &collection.ItemCount)
+}
+
+func uuidStrings(ids []uuid.UUID) []string {
+	values := make([]string, len(ids))
+	for i, id := range ids {
+		values[i] = id.String()
+	}
+	return values
+}
+
+func ValidateCollection(v *validator.Validator, collection *Collection) {
+	v.Check(collection.Name != "", "name", "must be provided")
+	v.Check(len(collection.Name) <= 200, "name", "must not be more than 200 bytes long")
+	v.Check(len(collection.Description) <= 2000, "description", "must not be more than 2000 bytes long")
+}
+
+// ValidateCollectionMovies check a bulk list of movie ids
+func ValidateCollectionMovies(v *validator.Validator, movieIDs []uuid.UUID) {
+	v.Check(len(movieIDs) >= 1, "movie_ids", "must contain at least 1 movie")
+	v.Check(len(movieIDs) <= 500, "movie_ids", "must not contain more than 500 movies")
+	v.Check(validator.Unique(uuidStrings(movieIDs)), "movie_ids", "must not contain duplicate values")
+}
@@ -0,0 +1,124 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"gin-project/internal/database"
+	"gin-project/internal/validator"
+	"github.com/google/uuid"
+	"time"
+)
+
+var (
+	ErrDuplicateCredit = errors.New("duplicate credit")
+)
+
+// CreditRoles hold the roles a person can be credited for on a movie
+var CreditRoles = []string{"actor", "director", "writer"}
+
+// Credit link a person to a movie with the role they had on it
+type Credit struct {
+	ID           uuid.UUID `json:"id"`
+	MovieID      uuid.UUID `json:"movie_id"`
+	PersonID     uuid.UUID `json:"person_id"`
+	PersonName   string    `json:"person_name"`
+	Role         string    `json:"role"`
+	Character    string    `json:"character,omitempty"`
+	BillingOrder int32     `json:"billing_order"`
+}
+
+// CreditModel define a model db for the movie credits
+type CreditModel struct {
+	service database.Service
+}
+
+func (m *CreditModel) Insert(ctx context.Context, credit *Credit) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	query := `INSERT INTO movie_credits (movie_id, person_id, role, character, billing_order)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, (SELECT name FROM people WHERE id = $2)`
+
+	args := []interface{}{credit.MovieID, credit.PersonID, credit.Role, credit.Character, credit.BillingOrder}
+	err := m.service.DB().QueryRowContext(ctx, query, args...).Scan(&credit.ID, &credit.PersonName)
+	if err != nil {
+		switch {
+		case uniqueViolation(err, "movie_credits_movie_id_person_id_role_character_key"):
+			return ErrDuplicateCredit
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// GetAllForMovie return the credits of a movie, directors and writers first
+// then the cast in billing order
+func (m *CreditModel) GetAllForMovie(ctx context.Context, movieID uuid.UUID) ([]*Credit, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	query := `SELECT movie_credits.id, movie_credits.movie_id, movie_credits.person_id, people.name,
+		movie_credits.role, movie_credits.character, movie_credits.billing_order
+	FROM movie_credits
+	INNER JOIN people ON people.id = movie_credits.person_id
+	WHERE movie_credits.movie_id = $1
+	ORDER BY array_position(ARRAY['director', 'writer', 'actor'], movie_credits.role),
+		movie_credits.billing_order, people.name`
+
+	rows, err := m.service.DB().QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credits := []*Credit{}
+	for rows.Next() {
+		var credit Credit
+		err = rows.Scan(
+			&credit.ID,
+			&credit.MovieID,
+			&credit.PersonID,
+			&credit.PersonName,
+			&credit.Role,
+			&credit.Character,
+			&credit.BillingOrder,
+		)
+		if err != nil {
+			return nil, err
+		}
+		credits = append(credits, &credit)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return credits, nil
+}
+
+func (m *CreditModel) Delete(ctx context.Context, movieID, id uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := m.service.DB().ExecContext(ctx, `DELETE FROM movie_credits WHERE movie_id = $1 AND id = $2`, movieID, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func ValidateCredit(v *validator.Validator, credit *Credit) {
+	v.Check(credit.PersonID != uuid.Nil, "person_id", "must be provided")
+	v.Check(validator.In(credit.Role, CreditRoles...), "role", "must be one of actor, director or writer")
+	v.Check(credit.Role == "actor" || credit.Character == "", "character", "must only be provided for actors")
+	v.Check(len(credit.Character) <= 500, "character", "must not be more than 500 bytes long")
+	v.Check(credit.BillingOrder >= 0, "billing_order", "must not be negative")
+}
@@ -0,0 +1,101 @@
+package data
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"strings"
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrCursorMismatch is a valid cursor sent along with other filters than
+	// the ones it was issued for
+	ErrCursorMismatch = errors.New("cursor issued for other filters")
+)
+
+// cursor point at a row of a keyset paginated listing, it records the sort
+// parameter, the sort keys of the row and its id used as a tie-breaker. Query
+// is the fingerprint of the filters the cursor was issued for, the same keys
+// select other rows, in another order for the relevance sort, under other
+// filters.
+type cursor struct {
+	Sort     string    `json:"s"`
+	Query    string    `json:"q"`
+	Keys     []string  `json:"k"`
+	ID       uuid.UUID `json:"i"`
+	Backward bool      `json:"b,omitempty"`
+}
+
+// encodeCursor serialize the cursor to an opaque token signed with HMAC-SHA256
+// so that clients cannot forge sort keys
+func encodeCursor(c cursor, secret []byte) string {
+	payload, _ := json.Marshal(c)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// decodeCursor verify the token signature and deserialize the cursor
+func decodeCursor(token string, secret []byte) (*cursor, error) {
+	encodedPayload, encodedSignature, found := strings.Cut(token, ".")
+	if !found {
+		return nil, ErrInvalidCursor
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, ErrInvalidCursor
+	}
+
+	var c cursor
+	err = json.Unmarshal(payload, &c)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// keysetColumn is one column of a keyset comparison, value is the placeholder
+// of the cursor value already cast to the column type
+type keysetColumn struct {
+	expr      string
+	direction string
+	value     string
+}
+
+// keysetCondition select the rows coming after the cursor in the given order,
+// the row comparison is expanded so that each column keeps its own direction:
+// (a > $1) OR (a = $1 AND b < $2) OR (a = $1 AND b = $2 AND id > $3)
+func keysetCondition(columns []keysetColumn) string {
+	var alternatives []string
+	for i, column := range columns {
+		var terms []string
+		for _, previous := range columns[:i] {
+			terms = append(terms, fmt.Sprintf("%s = %s", previous.expr, previous.value))
+		}
+		comparison := ">"
+		if column.direction == "DESC" {
+			comparison = "<"
+		}
+		terms = append(terms, fmt.Sprintf("%s %s %s", column.expr, comparison, column.value))
+		alternatives = append(alternatives, "("+strings.Join(terms, " AND ")+")")
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")"
+}
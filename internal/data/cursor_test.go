@@ -0,0 +1,85 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"slices"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	secret := []byte("secret")
+	want := cursor{Sort: "-year,title", Keys: []string{"1999", "Matrix"}, ID: uuid.New(), Backward: true}
+
+	got, err := decodeCursor(encodeCursor(want, secret), secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Sort != want.Sort || !slices.Equal(got.Keys, want.Keys) || got.ID != want.ID || got.Backward != want.Backward {
+		t.Errorf("decodeCursor() = %+v, want %+v", *got, want)
+	}
+}
+
+func TestCursorRejectsTampering(t *testing.T) {
+	token := encodeCursor(cursor{Sort: "title", Keys: []string{"Alien"}, ID: uuid.New()}, []byte("secret"))
+
+	tests := []string{
+		"",
+		"garbage",
+		token + "x",
+		"e30." + token[len(token)-43:],
+	}
+	for _, tt := range tests {
+		if _, err := decodeCursor(tt, []byte("secret")); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("decodeCursor(%q) error = %v, want ErrInvalidCursor", tt, err)
+		}
+	}
+
+	if _, err := decodeCursor(token, []byte("other secret")); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("decodeCursor() with wrong secret error = %v, want ErrInvalidCursor", err)
+	}
+}
+
+func TestKeysetCondition(t *testing.T) {
+	got := keysetCondition([]keysetColumn{
+		{"year", "DESC", "$2"},
+		{"title", "ASC", "$3"},
+		{"id", "ASC", "$4"},
+	})
+	want := "((year < $2) OR (year = $2 AND title > $3) OR (year = $2 AND title = $3 AND id > $4))"
+	if got != want {
+		t.Errorf("keysetCondition() = %s, want %s", got, want)
+	}
+}
+
+func TestCursorBoundToFilters(t *testing.T) {
+	secret := []byte("secret")
+	issued := NewMovieFilters()
+	issued.Title = "alien"
+
+	filters := NewFilters()
+	filters.Sort = "relevance"
+	filters.CursorSecret = secret
+	filters.Cursor = encodeCursor(cursor{Sort: "relevance", Query: issued.fingerprint(), Keys: []string{"0.5"}, ID: uuid.New()}, secret)
+
+	highlighted := issued
+	highlighted.Highlight = true
+	if highlighted.fingerprint() != issued.fingerprint() {
+		t.Error("the highlight must not change the fingerprint")
+	}
+
+	// the filters are checked before anything is queried
+	var m MovieModel
+	for _, other := range []func(*MovieFilters){
+		func(f *MovieFilters) { f.Title = "aliens" },
+		func(f *MovieFilters) { f.Genres = []string{"horror"} },
+		func(f *MovieFilters) { f.YearMin = 1979 },
+	} {
+		f := issued
+		other(&f)
+		if _, _, err := m.List(context.Background(), f, &filters); !errors.Is(err, ErrCursorMismatch) {
+			t.Errorf("List(%+v) error = %v, want ErrCursorMismatch", f, err)
+		}
+	}
+}
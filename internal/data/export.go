@@ -0,0 +1,110 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/lib/pq"
+	"strings"
+	"time"
+)
+
+// exportFetchSize is the number of rows read from the server-side cursor at a time
+const exportFetchSize = 500
+
+// ExportTimeout bound the duration of an export
+const ExportTimeout = 10 * time.Minute
+
+// Export stream every movie matching movieFilters, in the order of the sort
+// parameter of filters, to fn. The rows are read through a server-side cursor
+// so that the catalogue is never loaded in memory at once, pagination
+// parameters are ignored. Returning an error from fn stops the export.
+func (m *MovieModel) Export(ctx context.Context, movieFilters MovieFilters, filters Filters, fn func(*Movie) error) error {
+	ctx, cancel := context.WithTimeout(ctx, ExportTimeout)
+	defer cancel()
+
+	var orderBy []string
+	hasID := false
+	for _, field := range filters.sortFields() {
+		orderBy = append(orderBy, movieSortKeys[sortColumn(field)].expr+" "+sortDirection(field))
+		hasID = hasID || sortColumn(field) == "id"
+	}
+	if !hasID {
+		orderBy = append(orderBy, "id ASC")
+	}
+
+	args := []interface{}{movieFilters.Title}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	query := fmt.Sprintf(`
+			SELECT id, created_at, title, year, runtime, genres, version,
+				`+movieAverageRatingExpr+`,
+				`+movieRatingCountExpr+`
+			FROM movies
+			%s
+			ORDER BY %s`, movieFilters.where(arg), strings.Join(orderBy, ", "))
+
+	// cursors only live inside a transaction, a read-only one is enough
+	tx, err := m.service.DB().BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "DECLARE movies_export NO SCROLL CURSOR FOR "+query, args...)
+	if err != nil {
+		return err
+	}
+
+	for {
+		count, err := m.exportBatch(ctx, tx, fn)
+		if err != nil {
+			return err
+		}
+		if count < exportFetchSize {
+			break
+		}
+	}
+
+	return tx.Commit()
+}
+
+// exportBatch fetch the next rows of the export cursor and return how many were read
+func (m *MovieModel) exportBatch(ctx context.Context, tx *sql.Tx, fn func(*Movie) error) (int, error) {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("FETCH %d FROM movies_export", exportFetchSize))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		var movie Movie
+		err = rows.Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&movie.AverageRating,
+			&movie.RatingCount,
+		)
+		if err != nil {
+			return 0, err
+		}
+		err = fn(&movie)
+		if err != nil {
+			return 0, err
+		}
+		count++
+	}
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
@@ -0,0 +1,86 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// MovieFacetSafelist hold the facets Facets knows how to compute
+var MovieFacetSafelist = []string{"genres", "decade"}
+
+// FacetBucket is the number of movies sharing a facet value
+type FacetBucket struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// movieFacetQueries map each facet to the expression it groups on and its ordering
+var movieFacetQueries = map[string]struct{ from, group, order string }{
+	"genres": {"movies, unnest(genres) AS facet", "facet", "count(*) DESC, facet"},
+	"decade": {"movies", "(year / 10) * 10", "(year / 10) * 10"},
+}
+
+// Facets count the movies matching movieFilters grouped by each requested facet
+func (m *MovieModel) Facets(ctx context.Context, movieFilters MovieFilters, facets []string) (map[string][]FacetBucket, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	result := make(map[string][]FacetBucket, len(facets))
+	for _, facet := range facets {
+		facetQuery, ok := movieFacetQueries[facet]
+		if !ok {
+			panic("unsafe facet parameter: " + facet)
+		}
+
+		args := []interface{}{movieFilters.Title}
+		arg := func(value interface{}) string {
+			args = append(args, value)
+			return fmt.Sprintf("$%d", len(args))
+		}
+
+		query := fmt.Sprintf(`
+			SELECT (%[2]s)::text, count(*)
+			FROM %[1]s
+			%[3]s
+			GROUP BY 1
+			ORDER BY %[4]s`, facetQuery.from, facetQuery.group, movieFilters.where(arg), facetQuery.order)
+
+		buckets, err := m.facetBuckets(ctx, query, args)
+		if err != nil {
+			return nil, err
+		}
+
+		if facet == "decade" {
+			for i := range buckets {
+				buckets[i].Value += "s"
+			}
+		}
+		result[facet] = buckets
+	}
+
+	return result, nil
+}
+
+func (m *MovieModel) facetBuckets(ctx context.Context, query string, args []interface{}) ([]FacetBucket, error) {
+	rows, err := m.service.DB().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	buckets := []FacetBucket{}
+	for rows.Next() {
+		var bucket FacetBucket
+		err = rows.Scan(&bucket.Value, &bucket.Count)
+		if err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, bucket)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return buckets, nil
+}
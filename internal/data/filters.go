@@ -1,12 +1,19 @@
 package data
 
-import "gin-project/internal/validator"
+import (
+	"gin-project/internal/validator"
+	"math"
+	"strings"
+)
 
 type Filters struct {
 	Page         int      `form:"page"`
 	PageSize     int      `form:"page_size"`
 	Sort         string   `form:"sort"`
+	Cursor       string   `form:"cursor"`
 	SortSafelist []string `json:"-"`
+	// CursorSecret sign the cursors, it must be the same across requests
+	CursorSecret []byte `json:"-"`
 }
 
 func NewFilters() Filters {
@@ -23,6 +30,92 @@ func ValidateFilters(v *validator.Validator, f Filters) {
 	v.Check(f.Page <= 10_000_000, "page", "must be a maximum of 10 million")
 	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
 	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
-	// Check that the sort parameter matches a value in the safelist.
-	v.Check(validator.In(f.Sort, f.SortSafelist...), "sort", "invalid sort value")
+	// Check that every key of the sort parameter matches a value in the safelist.
+	v.Check(validSort(f.Sort, f.SortSafelist), "sort", "invalid sort value")
+	// The cursor carries its own sort parameter which must be in the safelist too.
+	if f.Cursor != "" {
+		c, err := decodeCursor(f.Cursor, f.CursorSecret)
+		v.Check(err == nil, "cursor", "invalid or tampered cursor")
+		v.Check(err != nil || validSort(c.Sort, f.SortSafelist), "cursor", "invalid sort value")
+	}
+}
+
+// validSort check a comma separated sort parameter, like "-year,title", only
+// holds safelisted keys and sorts on each column at most once
+func validSort(sort string, safelist []string) bool {
+	seen := make(map[string]bool)
+	for _, field := range strings.Split(sort, ",") {
+		if !validator.In(field, safelist...) {
+			return false
+		}
+		column := strings.TrimPrefix(field, "-")
+		if seen[column] {
+			return false
+		}
+		seen[column] = true
+	}
+	return true
+}
+
+// sortFields split the sort parameter into its keys, it panics if one of them
+// is not in the safelist as a guard against SQL injection
+func (f Filters) sortFields() []string {
+	fields := strings.Split(f.Sort, ",")
+	for _, field := range fields {
+		if !validator.In(field, f.SortSafelist...) {
+			panic("unsafe sort parameter: " + field)
+		}
+	}
+	return fields
+}
+
+// sortColumn return the sort key without its direction prefix
+func sortColumn(field string) string {
+	return strings.TrimPrefix(field, "-")
+}
+
+// sortDirection return the SQL direction matching the sort key prefix
+func sortDirection(field string) string {
+	if strings.HasPrefix(field, "-") {
+		return "DESC"
+	}
+	return "ASC"
+}
+
+// limit return the number of records per page for the LIMIT clause
+func (f Filters) limit() int {
+	return f.PageSize
+}
+
+// offset return the number of records to skip for the OFFSET clause
+func (f Filters) offset() int {
+	return (f.Page - 1) * f.PageSize
+}
+
+// Metadata hold the pagination details returned alongside a list of records
+type Metadata struct {
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty"`
+	PrevCursor   string `json:"prev_cursor,omitempty"`
+	// Facets is only filled when the client asks for facet counts
+	Facets map[string][]FacetBucket `json:"facets,omitempty"`
+}
+
+// calculateMetadata compute the pagination metadata, an empty Metadata is
+// returned when there are no records
+func calculateMetadata(totalRecords, page, pageSize int) Metadata {
+	if totalRecords == 0 {
+		return Metadata{}
+	}
+	return Metadata{
+		CurrentPage:  page,
+		PageSize:     pageSize,
+		FirstPage:    1,
+		LastPage:     int(math.Ceil(float64(totalRecords) / float64(pageSize))),
+		TotalRecords: totalRecords,
+	}
 }
@@ -0,0 +1,64 @@
+package data
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFiltersOffset(t *testing.T) {
+	f := Filters{Page: 3, PageSize: 20}
+	if f.limit() != 20 {
+		t.Errorf("limit() = %d, want 20", f.limit())
+	}
+	if f.offset() != 40 {
+		t.Errorf("offset() = %d, want 40", f.offset())
+	}
+}
+
+func TestCalculateMetadata(t *testing.T) {
+	got := calculateMetadata(21, 2, 10)
+	want := Metadata{CurrentPage: 2, PageSize: 10, FirstPage: 1, LastPage: 3, TotalRecords: 21}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("calculateMetadata() = %+v, want %+v", got, want)
+	}
+
+	if got := calculateMetadata(0, 1, 10); !reflect.DeepEqual(got, Metadata{}) {
+		t.Errorf("calculateMetadata() with no records = %+v, want empty", got)
+	}
+}
+
+func TestValidSort(t *testing.T) {
+	safelist := []string{"id", "title", "year", "-id", "-title", "-year"}
+	tests := []struct {
+		sort string
+		want bool
+	}{
+		{"title", true},
+		{"-year,title", true},
+		{"-year,title,id", true},
+		{"year,-year", false},
+		{"year,runtime", false},
+		{"year,", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := validSort(tt.sort, safelist); got != tt.want {
+			t.Errorf("validSort(%q) = %v, want %v", tt.sort, got, tt.want)
+		}
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	tests := map[string]string{
+		"Kubrick":   "Kubrick",
+		"100%":      `100\%`,
+		"a_b":       `a\_b`,
+		`back\`:     `back\\`,
+		`%_\ mixed`: `\%\_\\ mixed`,
+	}
+	for in, want := range tests {
+		if got := escapeLike(in); got != want {
+			t.Errorf("escapeLike(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -1,13 +1,25 @@
 package data
 
 import (
+	"errors"
 	"gin-project/internal/database"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
+// uniqueViolationCode is the SQLSTATE of a row clashing with a unique constraint
+const uniqueViolationCode = "23505"
+
 // Models create models struct base on MovieModel
 type Models struct {
-	Movies MovieModel
-	Users  UserModel
+	Movies      MovieModel
+	Users       UserModel
+	Tokens      TokenModel
+	Permissions PermissionModel
+	Reviews     ReviewModel
+	People      PersonModel
+	Credits     CreditModel
+	Collections CollectionModel
+	Revisions   RevisionModel
 }
 
 func NewModels(db *database.Service) Models {
@@ -18,5 +30,33 @@ func NewModels(db *database.Service) Models {
 		Users: UserModel{
 			service: *db,
 		},
+		Tokens: TokenModel{
+			service: *db,
+		},
+		Permissions: PermissionModel{
+			service: *db,
+		},
+		Reviews: ReviewModel{
+			service: *db,
+		},
+		People: PersonModel{
+			service: *db,
+		},
+		Credits: CreditModel{
+			service: *db,
+		},
+		Collections: CollectionModel{
+			service: *db,
+		},
+		Revisions: RevisionModel{
+			service: *db,
+		},
 	}
 }
+
+// uniqueViolation report whether postgres rejected a row because it clashes
+// with the unique constraint
+func uniqueViolation(err error, constraint string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode && pgErr.ConstraintName == constraint
+}
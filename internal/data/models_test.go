@@ -0,0 +1,28 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgconn"
+	"testing"
+)
+
+func TestUniqueViolation(t *testing.T) {
+	duplicate := &pgconn.PgError{Code: "23505", ConstraintName: "reviews_movie_id_user_id_key", Message: "duplicate key value"}
+
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{duplicate, true},
+		{fmt.Errorf("insert review: %w", duplicate), true},
+		{&pgconn.PgError{Code: "23505", ConstraintName: "reviews_pkey"}, false},
+		{&pgconn.PgError{Code: "23503", ConstraintName: "reviews_movie_id_user_id_key"}, false},
+		{errors.New(duplicate.Error()), false},
+	}
+	for _, tt := range tests {
+		if got := uniqueViolation(tt.err, "reviews_movie_id_user_id_key"); got != tt.want {
+			t.Errorf("uniqueViolation(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
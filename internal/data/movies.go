@@ -2,12 +2,19 @@ package data
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"gin-project/internal/database"
 	"gin-project/internal/validator"
 	"github.com/google/uuid"
 	"github.com/lib/pq"
+	"html"
+	"slices"
+	"strings"
 	"time"
 )
 
@@ -29,27 +36,117 @@ type Movie struct {
 	Runtime   Runtime   `json:"runtime"`
 	Genres    []string  `json:"genres,omitempty"`
 	Version   int32     `json:"version"`
+	// AverageRating and RatingCount are aggregated from the movie reviews
+	AverageRating float64 `json:"average_rating"`
+	RatingCount   int     `json:"rating_count"`
+	// Highlight is the HTML escaped title with the search terms wrapped in <b>
+	// tags, it is only filled by List when highlighting is requested
+	Highlight string `json:"highlight,omitempty"`
+	// DeletedAt is only set on the movies listed by ListTrash
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
-func (m *MovieModel) Insert(ctx context.Context, movie *Movie) error {
+// actorArg is the user_id recorded in the revisions, NULL when unknown
+func actorArg(actor uuid.UUID) interface{} {
+	if actor == uuid.Nil {
+		return nil
+	}
+	return actor
+}
+
+// Insert store the movie and record the change on behalf of actor
+func (m *MovieModel) Insert(ctx context.Context, movie *Movie, actor uuid.UUID) error {
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 	query := `
-			INSERT INTO movies (title, year, runtime, genres) 
-			VALUES ($1, $2, $3, $4) 
-			RETURNING id, created_at, version`
-	args := []interface{}{movie.Title, movie.Year, movie.Runtime, movie.Genres}
+			WITH inserted AS (
+				INSERT INTO movies (title, year, runtime, genres)
+				VALUES ($1, $2, $3, $4)
+				RETURNING id, created_at, version, ` + movieSnapshotExpr + ` AS snapshot
+			), revision AS (
+				` + insertRevisionSQL("insert", "inserted", "NULL::jsonb", "inserted.snapshot", "$5::uuid") + `
+			)
+			SELECT id, created_at, version FROM inserted`
+	args := []interface{}{movie.Title, movie.Year, movie.Runtime, movie.Genres, actorArg(actor)}
 	return m.service.DB().QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
 }
 
+// insertBatchSize is the number of movies inserted by each statement of
+// InsertMany, it keeps the statements below the postgres parameter limit
+const insertBatchSize = 500
+
+// InsertMany insert the movies in a single transaction so that either all of
+// them are stored or none, each batch is a multi-row statement and postgres
+// returns the rows in the VALUES order
+func (m *MovieModel) InsertMany(ctx context.Context, movies []*Movie, actor uuid.UUID) error {
+	if len(movies) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	tx, err := m.service.DB().BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for batch := range slices.Chunk(movies, insertBatchSize) {
+		err = insertBatch(ctx, tx, batch, actor)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func insertBatch(ctx context.Context, tx *sql.Tx, movies []*Movie, actor uuid.UUID) error {
+	values := make([]string, len(movies))
+	args := make([]interface{}, 0, 4*len(movies)+1)
+	args = append(args, actorArg(actor))
+	for i, movie := range movies {
+		n := len(args)
+		values[i] = fmt.Sprintf("($%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4)
+		args = append(args, movie.Title, movie.Year, movie.Runtime, movie.Genres)
+	}
+
+	query := `WITH inserted AS (
+		INSERT INTO movies (title, year, runtime, genres)
+		VALUES ` + strings.Join(values, ", ") + `
+		RETURNING id, created_at, version, ` + movieSnapshotExpr + ` AS snapshot
+	), revision AS (
+		` + insertRevisionSQL("insert", "inserted", "NULL::jsonb", "inserted.snapshot", "$1::uuid") + `
+	)
+	SELECT id, created_at, version FROM inserted`
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	i := 0
+	for rows.Next() {
+		err = rows.Scan(&movies[i].ID, &movies[i].CreatedAt, &movies[i].Version)
+		if err != nil {
+			return err
+		}
+		i++
+	}
+	return rows.Err()
+}
+
 func (m *MovieModel) Get(ctx context.Context, id string) (*Movie, error) {
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 	var movie Movie
 	query := `
-			SELECT id, created_at, title, year, runtime, genres, version
+			SELECT id, created_at, title, year, runtime, genres, version,
+				` + movieAverageRatingExpr + `,
+				` + movieRatingCountExpr + `
 			FROM movies
-			WHERE id = $1`
+			WHERE id = $1 AND deleted_at IS NULL`
 	err := m.service.DB().QueryRowContext(ctx, query, id).
 		Scan(&movie.ID,
 			&movie.CreatedAt,
@@ -57,7 +154,9 @@ func (m *MovieModel) Get(ctx context.Context, id string) (*Movie, error) {
 			&movie.Year,
 			&movie.Runtime,
 			pq.Array(&movie.Genres),
-			&movie.Version)
+			&movie.Version,
+			&movie.AverageRating,
+			&movie.RatingCount)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrRecordNotFound
@@ -67,15 +166,28 @@ func (m *MovieModel) Get(ctx context.Context, id string) (*Movie, error) {
 	return &movie, nil
 }
 
-func (m *MovieModel) Update(ctx context.Context, movie *Movie) error {
+// Update save the movie if it is still at movie.Version and record the change
+// on behalf of actor
+func (m *MovieModel) Update(ctx context.Context, movie *Movie, actor uuid.UUID) error {
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
+	// every CTE sees the row as it was before the statement, which gives the
+	// previous snapshot
 	query := `
-			UPDATE movies
-			SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1
-			WHERE id = $5
-			RETURNING version`
-	args := []interface{}{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), movie.ID}
+			WITH previous AS (
+				SELECT ` + movieSnapshotExpr + ` AS snapshot
+				FROM movies
+				WHERE id = $5
+			), updated AS (
+				UPDATE movies
+				SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1
+				WHERE id = $5 AND version = $6 AND deleted_at IS NULL
+				RETURNING id, version, ` + movieSnapshotExpr + ` AS snapshot
+			), revision AS (
+				` + insertRevisionSQL("update", "updated", "(SELECT snapshot FROM previous)", "updated.snapshot", "$7::uuid") + `
+			)
+			SELECT version FROM updated`
+	args := []interface{}{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), movie.ID, movie.Version, actorArg(actor)}
 	err := m.service.DB().QueryRowContext(ctx, query, args...).
 		Scan(&movie.Version)
 	if err != nil {
@@ -87,66 +199,426 @@ func (m *MovieModel) Update(ctx context.Context, movie *Movie) error {
 	return nil
 }
 
-func (m *MovieModel) Delete(ctx context.Context, id string) error {
+// Delete move the movie to the trash, it is purged later by Purge
+func (m *MovieModel) Delete(ctx context.Context, id string, actor uuid.UUID) error {
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
-	result, err := m.service.DB().ExecContext(ctx, `
-			DELETE FROM movies
-			WHERE id = $1`,
-		id)
-	rowsAffected, err := result.RowsAffected()
+	query := `
+			WITH deleted AS (
+				UPDATE movies
+				SET deleted_at = NOW()
+				WHERE id = $1 AND deleted_at IS NULL
+				RETURNING id, version, ` + movieSnapshotExpr + ` AS snapshot
+			), revision AS (
+				` + insertRevisionSQL("delete", "deleted", "deleted.snapshot", "NULL::jsonb", "$2::uuid") + `
+			)
+			SELECT count(*) FROM deleted`
+	var rowsAffected int
+	err := m.service.DB().QueryRowContext(ctx, query, id, actorArg(actor)).Scan(&rowsAffected)
+	if err != nil {
+		return err
+	}
 	// if no row affected, return error
 	if rowsAffected == 0 {
 		return ErrRecordNotFound
 	}
-	return err
+	return nil
+}
+
+// Restore take the movie out of the trash, the version is bumped so that
+// cached representations are invalidated
+func (m *MovieModel) Restore(ctx context.Context, id string, actor uuid.UUID) (*Movie, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	query := `
+			WITH restored AS (
+				UPDATE movies
+				SET deleted_at = NULL, version = version + 1
+				WHERE id = $1 AND deleted_at IS NOT NULL
+				RETURNING id, created_at, title, year, runtime, genres, version,
+					` + movieAverageRatingExpr + ` AS average_rating,
+					` + movieRatingCountExpr + ` AS rating_count,
+					` + movieSnapshotExpr + ` AS snapshot
+			), revision AS (
+				` + insertRevisionSQL("restore", "restored", "NULL::jsonb", "restored.snapshot", "$2::uuid") + `
+			)
+			SELECT id, created_at, title, year, runtime, genres, version, average_rating, rating_count
+			FROM restored`
+	var movie Movie
+	err := m.service.DB().QueryRowContext(ctx, query, id, actorArg(actor)).
+		Scan(&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&movie.AverageRating,
+			&movie.RatingCount)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &movie, nil
 }
 
-func (m *MovieModel) List(ctx context.Context, title string, genres []string, filters *Filters) ([]*Movie, error) {
-	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+// ListTrash list the soft-deleted movies, most recently deleted first
+func (m *MovieModel) ListTrash(ctx context.Context, filters Filters) ([]*Movie, Metadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
-	var movies []*Movie
 	query := `
-	
-			SELECT id, created_at, title, year, runtime, genres, version
+			SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version, deleted_at
 			FROM movies
-			WHERE (LOWER(title) ILike LOWER($1) OR $1 = '') 
-			AND (genres @> $2 OR $2 IS NULL)
-			ORDER BY
-				CASE WHEN $3 IN ('title', '-title') THEN title END ASC,
-				CASE WHEN $3 IN ('year', '-year') THEN year END DESC,
-				CASE WHEN $3 IN ('runtime', '-runtime') THEN runtime END DESC,
-				CASE WHEN $3 IN ('created_at', '-created_at') THEN created_at END DESC
-			LIMIT $4 OFFSET $5`
-
-	rows, err := m.service.DB().QueryContext(ctx, query, title, pq.Array(genres), filters.Sort, filters.PageSize, filters.Page)
+			WHERE deleted_at IS NOT NULL
+			ORDER BY deleted_at DESC, id ASC
+			LIMIT $1 OFFSET $2`
+	rows, err := m.service.DB().QueryContext(ctx, query, filters.limit(), filters.offset())
 	if err != nil {
-		return nil, err
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	movies := []*Movie{}
+	for rows.Next() {
+		var movie Movie
+		err = rows.Scan(&totalRecords,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&movie.DeletedAt)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		movies = append(movies, &movie)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return movies, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// Purge permanently remove the movies deleted more than retention ago and
+// return how many were removed, their revisions are kept, the last one being
+// the delete which sent them to the trash
+func (m *MovieModel) Purge(ctx context.Context, retention time.Duration) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	result, err := m.service.DB().ExecContext(ctx, `
+			DELETE FROM movies
+			WHERE deleted_at < $1`,
+		time.Now().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// highlightStart and highlightStop delimit the search terms in the headline
+// built by the database, private use characters are used so that the
+// delimiters survive the HTML escaping of the title
+const (
+	highlightStart = "\uE000"
+	highlightStop  = "\uE001"
+)
+
+// renderHighlight escape the headline built by the database then turn the
+// delimiters of the search terms into <b> tags, so that a title can never
+// inject markup
+func renderHighlight(headline string) string {
+	if headline == "" {
+		return ""
+	}
+	headline = html.EscapeString(headline)
+	return strings.NewReplacer(highlightStart, "<b>", highlightStop, "</b>").Replace(headline)
+}
+
+// movieSortKeys map the sort columns to their SQL expression and type, the
+// relevance rank is negated so that the best matches come first in ascending order
+var movieSortKeys = map[string]struct{ expr, sqlType string }{
+	"id":             {"id", "uuid"},
+	"title":          {"title", "text"},
+	"year":           {"year", "integer"},
+	"runtime":        {"runtime", "integer"},
+	"relevance":      {"-ts_rank(to_tsvector('simple', title), plainto_tsquery('simple', $1))", "real"},
+	"average_rating": {movieAverageRatingExpr, "numeric"},
+	"rating_count":   {movieRatingCountExpr, "bigint"},
+}
+
+// MovieFilters narrow down the movies returned by List
+type MovieFilters struct {
+	Title         string    `form:"title"`
+	Genres        []string  `form:"genres"`
+	GenresMode    string    `form:"genres_mode"`
+	ExcludeGenres []string  `form:"exclude_genres"`
+	YearMin       int32     `form:"year_min"`
+	YearMax       int32     `form:"year_max"`
+	RuntimeMin    Runtime   `form:"runtime_min"`
+	RuntimeMax    Runtime   `form:"runtime_max"`
+	CreatedAfter  time.Time `form:"created_after"`
+	CreatedBefore time.Time `form:"created_before"`
+	// PersonID keep the movies the person is credited on
+	PersonID string `form:"person_id"`
+	// Highlight request the title with the search terms highlighted
+	Highlight bool `form:"highlight"`
+}
+
+func NewMovieFilters() MovieFilters {
+	return MovieFilters{
+		GenresMode: "all",
+	}
+}
+
+// fingerprint identify the movies selected by the filters and their relevance
+// to the title, the highlight only changes how they are rendered
+func (f MovieFilters) fingerprint() string {
+	f.Highlight = false
+	js, _ := json.Marshal(f)
+	sum := sha256.Sum256(js)
+	return base64.RawURLEncoding.EncodeToString(sum[:16])
+}
+
+func ValidateMovieFilters(v *validator.Validator, f MovieFilters) {
+	v.Check(validator.In(f.GenresMode, "any", "all", "none"), "genres_mode", "must be one of any, all or none")
+	v.Check(f.YearMin >= 0, "year_min", "must not be negative")
+	v.Check(f.YearMax >= 0, "year_max", "must not be negative")
+	v.Check(f.YearMax == 0 || f.YearMin <= f.YearMax, "year_min", "must not be greater than year_max")
+	v.Check(f.RuntimeMin >= 0, "runtime_min", "must not be negative")
+	v.Check(f.RuntimeMax >= 0, "runtime_max", "must not be negative")
+	v.Check(f.RuntimeMax == 0 || f.RuntimeMin <= f.RuntimeMax, "runtime_min", "must not be greater than runtime_max")
+	v.Check(f.CreatedBefore.IsZero() || f.CreatedAfter.Before(f.CreatedBefore), "created_after", "must be before created_before")
+	if f.PersonID != "" {
+		_, err := uuid.Parse(f.PersonID)
+		v.Check(err == nil, "person_id", "must be a valid UUID")
+	}
+}
+
+// where build the WHERE clause of the filters, arg register a query argument and
+// return its placeholder. The title must already be bound to $1.
+func (f MovieFilters) where(arg func(value interface{}) string) string {
+	conditions := []string{"deleted_at IS NULL", "(to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')"}
+
+	if len(f.Genres) > 0 {
+		switch f.GenresMode {
+		case "any":
+			conditions = append(conditions, "genres && "+arg(pq.Array(f.Genres)))
+		case "none":
+			conditions = append(conditions, "NOT genres && "+arg(pq.Array(f.Genres)))
+		default:
+			conditions = append(conditions, "genres @> "+arg(pq.Array(f.Genres)))
+		}
+	}
+	if len(f.ExcludeGenres) > 0 {
+		conditions = append(conditions, "NOT genres && "+arg(pq.Array(f.ExcludeGenres)))
+	}
+	if f.YearMin > 0 {
+		conditions = append(conditions, "year >= "+arg(f.YearMin))
+	}
+	if f.YearMax > 0 {
+		conditions = append(conditions, "year <= "+arg(f.YearMax))
+	}
+	if f.RuntimeMin > 0 {
+		conditions = append(conditions, "runtime >= "+arg(f.RuntimeMin))
+	}
+	if f.RuntimeMax > 0 {
+		conditions = append(conditions, "runtime <= "+arg(f.RuntimeMax))
+	}
+	if !f.CreatedAfter.IsZero() {
+		conditions = append(conditions, "created_at > "+arg(f.CreatedAfter))
+	}
+	if !f.CreatedBefore.IsZero() {
+		conditions = append(conditions, "created_at < "+arg(f.CreatedBefore))
+	}
+	if f.PersonID != "" {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM movie_credits WHERE movie_credits.movie_id = movies.id AND movie_credits.person_id = "+arg(f.PersonID)+")")
+	}
+
+	return "WHERE " + strings.Join(conditions, "\n\t\t\tAND ")
+}
+
+// List search movies by title with Postgres full-text search, the 'simple'
+// configuration must match the movies_title_idx index expression.
+// Results are paginated by page, or by keyset when filters carries a cursor.
+func (m *MovieModel) List(ctx context.Context, movieFilters MovieFilters, filters *Filters) ([]*Movie, Metadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	f := *filters
+	var after *cursor
+	if f.Cursor != "" {
+		var err error
+		after, err = decodeCursor(f.Cursor, f.CursorSecret)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		if after.Query != movieFilters.fingerprint() {
+			return nil, Metadata{}, ErrCursorMismatch
+		}
+		// the cursor sort wins so that following a cursor keeps the same order
+		f.Sort = after.Sort
+	}
+
+	// the id is appended as a tie-breaker so that the order is stable, which
+	// keyset pagination relies on
+	type orderKey struct {
+		expr, sqlType, direction string
+	}
+	var order []orderKey
+	hasID := false
+	for _, field := range f.sortFields() {
+		sortKey := movieSortKeys[sortColumn(field)]
+		order = append(order, orderKey{sortKey.expr, sortKey.sqlType, sortDirection(field)})
+		hasID = hasID || sortColumn(field) == "id"
+	}
+	if !hasID {
+		order = append(order, orderKey{"id", "uuid", "ASC"})
+	}
+	// the sort keys, without the tie-breaker, are recorded in the cursors
+	sortKeyCount := len(f.sortFields())
+
+	args := []interface{}{movieFilters.Title}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	highlight := arg(movieFilters.Highlight)
+	headlineOptions := arg("StartSel=" + highlightStart + ", StopSel=" + highlightStop + ", HighlightAll=true")
+	where := movieFilters.where(arg)
+
+	countExpr := "count(*) OVER()"
+	var pagination string
+	if after == nil {
+		pagination = fmt.Sprintf("LIMIT %s OFFSET %s", arg(f.limit()), arg(f.offset()))
+	} else {
+		if len(after.Keys) != sortKeyCount {
+			return nil, Metadata{}, ErrInvalidCursor
+		}
+		// walking backward reverses the order, rows are flipped back once read
+		if after.Backward {
+			for i := range order {
+				order[i].direction = map[string]string{"ASC": "DESC", "DESC": "ASC"}[order[i].direction]
+			}
+		}
+		var columns []keysetColumn
+		for i, key := range order {
+			var value string
+			if i < sortKeyCount {
+				value = fmt.Sprintf("CAST(%s AS %s)", arg(after.Keys[i]), key.sqlType)
+			} else {
+				value = arg(after.ID)
+			}
+			columns = append(columns, keysetColumn{key.expr, key.direction, value})
+		}
+		// the total is not counted in keyset mode, that would defeat its purpose
+		countExpr = "0"
+		where += "\n\t\t\tAND " + keysetCondition(columns)
+		// fetch one extra row to know if there is another page
+		pagination = "LIMIT " + arg(f.limit()+1)
+	}
+
+	var keyColumns, orderBy []string
+	for i, key := range order {
+		if i < sortKeyCount {
+			keyColumns = append(keyColumns, fmt.Sprintf("(%s)::text", key.expr))
+		}
+		orderBy = append(orderBy, key.expr+" "+key.direction)
+	}
+
+	query := fmt.Sprintf(`
+			SELECT %[1]s, id, created_at, title, year, runtime, genres, version,
+				`+movieAverageRatingExpr+`,
+				`+movieRatingCountExpr+`,
+				CASE WHEN %[2]s AND $1 <> ''
+					THEN ts_headline('simple', title, plainto_tsquery('simple', $1), %[7]s)
+					ELSE ''
+				END,
+				%[3]s
+			FROM movies
+			%[4]s
+			ORDER BY %[5]s
+			%[6]s`, countExpr, highlight, strings.Join(keyColumns, ", "), where, strings.Join(orderBy, ", "), pagination, headlineOptions)
+
+	rows, err := m.service.DB().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
 	}
 
 	// close rows
 	defer rows.Close()
+	totalRecords := 0
+	var movies []*Movie
+	var keys [][]string
 	// iterate over rows
 	for rows.Next() {
 		var movie Movie
-		err = rows.Scan(&movie.ID,
+		key := make([]string, sortKeyCount)
+		dest := []interface{}{&totalRecords,
+			&movie.ID,
 			&movie.CreatedAt,
 			&movie.Title,
 			&movie.Year,
 			&movie.Runtime,
 			pq.Array(&movie.Genres),
-			&movie.Version)
+			&movie.Version,
+			&movie.AverageRating,
+			&movie.RatingCount,
+			&movie.Highlight}
+		for i := range key {
+			dest = append(dest, &key[i])
+		}
+		err = rows.Scan(dest...)
 		if err != nil {
-			return nil, err
+			return nil, Metadata{}, err
 		}
+		movie.Highlight = renderHighlight(movie.Highlight)
 		movies = append(movies, &movie)
+		keys = append(keys, key)
 	}
 	// check for errors from iterating over rows
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, Metadata{}, err
+	}
+
+	var metadata Metadata
+	var hasNext, hasPrev bool
+	if after == nil {
+		metadata = calculateMetadata(totalRecords, f.Page, f.PageSize)
+		hasNext = f.offset()+len(movies) < totalRecords
+		hasPrev = f.Page > 1
+	} else {
+		metadata = Metadata{PageSize: f.PageSize}
+		more := len(movies) > f.limit()
+		if more {
+			movies, keys = movies[:f.limit()], keys[:f.limit()]
+		}
+		if after.Backward {
+			slices.Reverse(movies)
+			slices.Reverse(keys)
+			hasNext, hasPrev = true, more
+		} else {
+			hasNext, hasPrev = more, true
+		}
+	}
+
+	if len(movies) > 0 {
+		first, last := 0, len(movies)-1
+		if hasNext {
+			metadata.NextCursor = encodeCursor(cursor{Sort: f.Sort, Query: movieFilters.fingerprint(), Keys: keys[last], ID: movies[last].ID}, f.CursorSecret)
+		}
+		if hasPrev {
+			metadata.PrevCursor = encodeCursor(cursor{Sort: f.Sort, Query: movieFilters.fingerprint(), Keys: keys[first], ID: movies[first].ID, Backward: true}, f.CursorSecret)
+		}
 	}
 
-	return movies, nil
+	return movies, metadata, nil
 }
 
 func ValidateMovie(v *validator.Validator, movie *Movie) {
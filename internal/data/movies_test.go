@@ -0,0 +1,62 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMovieFiltersWhere(t *testing.T) {
+	f := NewMovieFilters()
+	f.Genres = []string{"drama"}
+	f.GenresMode = "none"
+	f.YearMin = 1990
+	f.RuntimeMax = 120
+	f.CreatedAfter = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	args := []interface{}{f.Title}
+	where := f.where(func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	})
+
+	for _, condition := range []string{"NOT genres && $2", "year >= $3", "runtime <= $4", "created_at > $5"} {
+		if !strings.Contains(where, condition) {
+			t.Errorf("where() = %q, missing %q", where, condition)
+		}
+	}
+	if strings.Contains(where, "year <=") {
+		t.Errorf("where() = %q, unset year_max must not be filtered", where)
+	}
+	if len(args) != 5 {
+		t.Errorf("expected 5 arguments, got %d", len(args))
+	}
+}
+
+func TestRenderHighlight(t *testing.T) {
+	tests := []struct {
+		headline, want string
+	}{
+		{"", ""},
+		{"The " + highlightStart + "Godfather" + highlightStop, "The <b>Godfather</b>"},
+		{"<script>alert(1)</script> " + highlightStart + "Rocky" + highlightStop, "&lt;script&gt;alert(1)&lt;/script&gt; <b>Rocky</b>"},
+		{"Fast & " + highlightStart + "Furious" + highlightStop, "Fast &amp; <b>Furious</b>"},
+	}
+	for _, tt := range tests {
+		if got := renderHighlight(tt.headline); got != tt.want {
+			t.Errorf("renderHighlight(%q) = %q, want %q", tt.headline, got, tt.want)
+		}
+	}
+}
+
+func TestRelevanceSort(t *testing.T) {
+	// ascending order on the negated rank puts the best matches first
+	key := movieSortKeys[sortColumn("relevance")]
+	if sortDirection("relevance") != "ASC" || !strings.HasPrefix(key.expr, "-ts_rank(") {
+		t.Errorf("relevance sorts on %s %s, want the negated rank ascending", key.expr, sortDirection("relevance"))
+	}
+	if !strings.Contains(key.expr, "plainto_tsquery('simple', $1)") {
+		t.Errorf("relevance must rank against the title search, got %s", key.expr)
+	}
+}
@@ -0,0 +1,164 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"gin-project/internal/database"
+	"gin-project/internal/validator"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+type Person struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"-"`
+	Name      string    `json:"name"`
+	Biography string    `json:"biography,omitempty"`
+	Version   int32     `json:"version"`
+}
+
+// PersonModel define a model db for the people credited on movies
+type PersonModel struct {
+	service database.Service
+}
+
+func (m *PersonModel) Insert(ctx context.Context, person *Person) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	query := `INSERT INTO people (name, biography)
+	VALUES ($1, $2)
+	RETURNING id, created_at, version`
+
+	return m.service.DB().QueryRowContext(ctx, query, person.Name, person.Biography).Scan(&person.ID, &person.CreatedAt, &person.Version)
+}
+
+func (m *PersonModel) Get(ctx context.Context, id uuid.UUID) (*Person, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	query := `SELECT id, created_at, name, biography, version
+	FROM people
+	WHERE id = $1`
+
+	var person Person
+	err := m.service.DB().QueryRowContext(ctx, query, id).Scan(
+		&person.ID,
+		&person.CreatedAt,
+		&person.Name,
+		&person.Biography,
+		&person.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &person, nil
+}
+
+// List return the people whose name contains name, paginated and sorted by filters
+func (m *PersonModel) List(ctx context.Context, name string, filters Filters) ([]*Person, Metadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var orderBy []string
+	for _, field := range filters.sortFields() {
+		orderBy = append(orderBy, sortColumn(field)+" "+sortDirection(field))
+	}
+
+	query := fmt.Sprintf(`SELECT count(*) OVER(), id, created_at, name, biography, version
+	FROM people
+	WHERE (name ILIKE '%%' || $1 || '%%' ESCAPE '\' OR $1 = '')
+	ORDER BY %s, id ASC
+	LIMIT $2 OFFSET $3`, strings.Join(orderBy, ", "))
+
+	rows, err := m.service.DB().QueryContext(ctx, query, escapeLike(name), filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	people := []*Person{}
+	for rows.Next() {
+		var person Person
+		err = rows.Scan(
+			&totalRecords,
+			&person.ID,
+			&person.CreatedAt,
+			&person.Name,
+			&person.Biography,
+			&person.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		people = append(people, &person)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return people, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (m *PersonModel) Update(ctx context.Context, person *Person) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	query := `UPDATE people
+	SET name = $1, biography = $2, version = version + 1
+	WHERE id = $3 AND version = $4
+	RETURNING version`
+
+	args := []interface{}{person.Name, person.Biography, person.ID, person.Version}
+	err := m.service.DB().QueryRowContext(ctx, query, args...).Scan(&person.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *PersonModel) Delete(ctx context.Context, id uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := m.service.DB().ExecContext(ctx, `DELETE FROM people WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func ValidatePerson(v *validator.Validator, person *Person) {
+	v.Check(person.Name != "", "name", "must be provided")
+	v.Check(len(person.Name) <= 500, "name", "must not be more than 500 bytes long")
+	v.Check(len(person.Biography) <= 10_000, "biography", "must not be more than 10000 bytes long")
+}
+
+// likeEscaper escape the wildcards of a LIKE pattern, with \ as the escape character
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// escapeLike make s match literally inside a LIKE pattern using ESCAPE '\'
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
@@ -0,0 +1,71 @@
+package data
+
+import (
+	"context"
+	"gin-project/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"time"
+)
+
+// Permissions hold the permission codes, like "movies:read", granted to a user
+type Permissions []string
+
+// Include check if the permission code is in the slice
+func (p Permissions) Include(code string) bool {
+	for i := range p {
+		if code == p[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// PermissionModel define a model db for permission
+type PermissionModel struct {
+	service database.Service
+}
+
+func (m *PermissionModel) GetAllForUser(ctx context.Context, userID uuid.UUID) (Permissions, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	query := `SELECT permissions.code
+	FROM permissions
+	INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
+	WHERE users_permissions.user_id = $1`
+
+	rows, err := m.service.DB().QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var permissions Permissions
+	for rows.Next() {
+		var permission string
+		err = rows.Scan(&permission)
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+// AddForUser grant the permission codes to the user
+func (m *PermissionModel) AddForUser(ctx context.Context, userID uuid.UUID, codes ...string) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	query := `INSERT INTO users_permissions
+	SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+	ON CONFLICT DO NOTHING`
+
+	_, err := m.service.DB().ExecContext(ctx, query, userID, pq.Array(codes))
+	return err
+}
@@ -0,0 +1,192 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"gin-project/internal/database"
+	"gin-project/internal/validator"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+var (
+	ErrDuplicateReview = errors.New("duplicate review")
+)
+
+type Review struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	MovieID   uuid.UUID `json:"movie_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Rating    int32     `json:"rating"`
+	Body      string    `json:"body"`
+	Version   int32     `json:"version"`
+}
+
+// ReviewModel define a model db for review
+type ReviewModel struct {
+	service database.Service
+}
+
+// the average rating and rating count of a movie are computed from its reviews,
+// these expressions are shared by the movie queries so that they can be sorted on
+const (
+	movieAverageRatingExpr = `(SELECT COALESCE(round(avg(reviews.rating), 2), 0) FROM reviews WHERE reviews.movie_id = movies.id)`
+	movieRatingCountExpr   = `(SELECT count(*) FROM reviews WHERE reviews.movie_id = movies.id)`
+)
+
+// reviewedMovieListed keep the reviews of the movies in the trash from being
+// changed, like the movies themselves
+const reviewedMovieListed = `EXISTS (SELECT 1 FROM movies WHERE movies.id = reviews.movie_id AND movies.deleted_at IS NULL)`
+
+func (m *ReviewModel) Insert(ctx context.Context, review *Review) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	query := `INSERT INTO reviews (movie_id, user_id, rating, body)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, created_at, updated_at, version`
+
+	args := []interface{}{review.MovieID, review.UserID, review.Rating, review.Body}
+	err := m.service.DB().QueryRowContext(ctx, query, args...).Scan(&review.ID, &review.CreatedAt, &review.UpdatedAt, &review.Version)
+	if err != nil {
+		switch {
+		case uniqueViolation(err, "reviews_movie_id_user_id_key"):
+			return ErrDuplicateReview
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *ReviewModel) Get(ctx context.Context, movieID, id uuid.UUID) (*Review, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	query := `SELECT reviews.id, reviews.created_at, reviews.updated_at, reviews.movie_id, reviews.user_id,
+		reviews.rating, reviews.body, reviews.version
+	FROM reviews
+	INNER JOIN movies ON movies.id = reviews.movie_id
+	WHERE reviews.movie_id = $1 AND reviews.id = $2 AND movies.deleted_at IS NULL`
+
+	var review Review
+	err := m.service.DB().QueryRowContext(ctx, query, movieID, id).Scan(
+		&review.ID,
+		&review.CreatedAt,
+		&review.UpdatedAt,
+		&review.MovieID,
+		&review.UserID,
+		&review.Rating,
+		&review.Body,
+		&review.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &review, nil
+}
+
+// GetAllForMovie list the reviews of a movie, paginated and sorted by filters
+func (m *ReviewModel) GetAllForMovie(ctx context.Context, movieID uuid.UUID, filters Filters) ([]*Review, Metadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var orderBy []string
+	for _, field := range filters.sortFields() {
+		orderBy = append(orderBy, sortColumn(field)+" "+sortDirection(field))
+	}
+
+	query := fmt.Sprintf(`SELECT count(*) OVER(), id, created_at, updated_at, movie_id, user_id, rating, body, version
+	FROM reviews
+	WHERE movie_id = $1
+	ORDER BY %s, id ASC
+	LIMIT $2 OFFSET $3`, strings.Join(orderBy, ", "))
+
+	rows, err := m.service.DB().QueryContext(ctx, query, movieID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	reviews := []*Review{}
+	for rows.Next() {
+		var review Review
+		err = rows.Scan(
+			&totalRecords,
+			&review.ID,
+			&review.CreatedAt,
+			&review.UpdatedAt,
+			&review.MovieID,
+			&review.UserID,
+			&review.Rating,
+			&review.Body,
+			&review.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		reviews = append(reviews, &review)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return reviews, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (m *ReviewModel) Update(ctx context.Context, review *Review) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	query := `UPDATE reviews
+	SET rating = $1, body = $2, updated_at = NOW(), version = version + 1
+	WHERE id = $3 AND version = $4 AND ` + reviewedMovieListed + `
+	RETURNING updated_at, version`
+
+	args := []interface{}{review.Rating, review.Body, review.ID, review.Version}
+	err := m.service.DB().QueryRowContext(ctx, query, args...).Scan(&review.UpdatedAt, &review.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *ReviewModel) Delete(ctx context.Context, id uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := m.service.DB().ExecContext(ctx, `DELETE FROM reviews WHERE id = $1 AND `+reviewedMovieListed, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func ValidateReview(v *validator.Validator, review *Review) {
+	v.Check(review.Rating >= 1, "rating", "must be at least 1")
+	v.Check(review.Rating <= 10, "rating", "must not be more than 10")
+	v.Check(len(review.Body) <= 10_000, "body", "must not be more than 10000 bytes long")
+}
@@ -0,0 +1,154 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"gin-project/internal/database"
+	"github.com/google/uuid"
+	"time"
+)
+
+// MovieSnapshot is the state of a movie stored in its revisions
+type MovieSnapshot struct {
+	ID      uuid.UUID `json:"id"`
+	Title   string    `json:"title"`
+	Year    int32     `json:"year"`
+	Runtime Runtime   `json:"runtime"`
+	Genres  []string  `json:"genres"`
+	Version int32     `json:"version"`
+}
+
+// Revision record one change of a movie, Before is nil for an insert and After
+// is nil for a delete
+type Revision struct {
+	ID        uuid.UUID      `json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	MovieID   uuid.UUID      `json:"movie_id"`
+	Version   int32          `json:"version"`
+	Operation string         `json:"operation"`
+	Before    *MovieSnapshot `json:"before"`
+	After     *MovieSnapshot `json:"after"`
+	UserID    *uuid.UUID     `json:"user_id"`
+}
+
+// RevisionModel define a model db for the movie change history, revisions are
+// written by MovieModel along with each change
+type RevisionModel struct {
+	service database.Service
+}
+
+// movieSnapshotExpr build the snapshot of the movie row in scope, it must stay
+// in sync with MovieSnapshot
+const movieSnapshotExpr = `jsonb_build_object('id', id, 'title', title, 'year', year, 'runtime', runtime, 'genres', genres, 'version', version)`
+
+// insertRevisionSQL is a data-modifying CTE recording the change of the rows
+// returned by the changed CTE, which must expose id, version and snapshot.
+// before is the snapshot expression of the previous state, or NULL.
+func insertRevisionSQL(operation, changed, before, after, actor string) string {
+	return `INSERT INTO movie_revisions (movie_id, version, operation, before, after, user_id)
+			SELECT ` + changed + `.id, ` + changed + `.version, '` + operation + `', ` + before + `, ` + after + `, ` + actor + `
+			FROM ` + changed
+}
+
+const revisionColumns = `id, created_at, movie_id, version, operation, before, after, user_id`
+
+func scanRevision(row interface{ Scan(...any) error }, revision *Revision) error {
+	var before, after []byte
+	err := row.Scan(
+		&revision.ID,
+		&revision.CreatedAt,
+		&revision.MovieID,
+		&revision.Version,
+		&revision.Operation,
+		&before,
+		&after,
+		&revision.UserID,
+	)
+	if err != nil {
+		return err
+	}
+	for _, snapshot := range []struct {
+		raw  []byte
+		dest **MovieSnapshot
+	}{{before, &revision.Before}, {after, &revision.After}} {
+		if snapshot.raw == nil {
+			continue
+		}
+		*snapshot.dest = &MovieSnapshot{}
+		err = json.Unmarshal(snapshot.raw, *snapshot.dest)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetAllForMovie list the revisions of a movie, most recent first
+func (m *RevisionModel) GetAllForMovie(ctx context.Context, movieID uuid.UUID, filters Filters) ([]*Revision, Metadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	query := `SELECT count(*) OVER(), ` + revisionColumns + `
+	FROM movie_revisions
+	WHERE movie_id = $1
+	ORDER BY created_at DESC, version DESC, id
+	LIMIT $2 OFFSET $3`
+
+	rows, err := m.service.DB().QueryContext(ctx, query, movieID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	revisions := []*Revision{}
+	for rows.Next() {
+		var revision Revision
+		err = scanRevision(countedRow{rows, &totalRecords}, &revision)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		revisions = append(revisions, &revision)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return revisions, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// GetVersion return the revision which produced the given version of the movie
+func (m *RevisionModel) GetVersion(ctx context.Context, movieID uuid.UUID, version int32) (*Revision, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + revisionColumns + `
+	FROM movie_revisions
+	WHERE movie_id = $1 AND version = $2 AND after IS NOT NULL
+	ORDER BY created_at DESC
+	LIMIT 1`
+
+	var revision Revision
+	err := scanRevision(m.service.DB().QueryRowContext(ctx, query, movieID, version), &revision)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &revision, nil
+}
+
+// countedRow scan the leading window count of a listing before the row columns
+type countedRow struct {
+	rows  *sql.Rows
+	count *int
+}
+
+func (r countedRow) Scan(dest ...any) error {
+	return r.rows.Scan(append([]any{r.count}, dest...)...)
+}
@@ -0,0 +1,49 @@
+package data
+
+import (
+	"github.com/google/uuid"
+	"testing"
+	"time"
+)
+
+// fakeRow scan fixed values, as the database driver would
+type fakeRow []any
+
+func (r fakeRow) Scan(dest ...any) error {
+	for i, value := range r {
+		switch d := dest[i].(type) {
+		case *uuid.UUID:
+			*d = value.(uuid.UUID)
+		case **uuid.UUID:
+			*d = nil
+		case *time.Time:
+			*d = value.(time.Time)
+		case *int32:
+			*d = value.(int32)
+		case *string:
+			*d = value.(string)
+		case *[]byte:
+			if value != nil {
+				*d = value.([]byte)
+			}
+		}
+	}
+	return nil
+}
+
+func TestScanRevision(t *testing.T) {
+	// the snapshots are built in SQL, where the runtime is a bare number
+	after := []byte(`{"id": "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "title": "Moana", "year": 2016, "runtime": 107, "genres": ["animation"], "version": 2}`)
+	row := fakeRow{uuid.New(), time.Now(), uuid.New(), int32(2), "update", nil, after, nil}
+
+	var revision Revision
+	if err := scanRevision(row, &revision); err != nil {
+		t.Fatalf("scanRevision: %v", err)
+	}
+	if revision.Before != nil {
+		t.Errorf("expected no before snapshot, got %+v", revision.Before)
+	}
+	if revision.After == nil || revision.After.Runtime != 107 || revision.After.Title != "Moana" || revision.After.Version != 2 {
+		t.Errorf("unexpected after snapshot %+v", revision.After)
+	}
+}
@@ -1,30 +1,136 @@
 package data
 
 import (
+	"database/sql/driver"
 	"errors"
+	"fmt"
+	"math"
+	"regexp"
 	"strconv"
 	"strings"
 )
 
 var ErrInvalidRuntimeFormat = errors.New("invalid runtime format")
 
+// Runtime is a movie runtime in minutes, it renders as "<runtime> mins" and
+// accepts "123", "123 mins", "2h 3m" or the ISO-8601 duration "PT2H3M"
 type Runtime int32
 
+var (
+	runtimeHoursMinutesRX = regexp.MustCompile(`^(?:(\d+)\s*h)?\s*(?:(\d+)\s*m)?$`)
+	runtimeISO8601RX      = regexp.MustCompile(`^PT(?:(\d+)H)?(?:(\d+)M)?$`)
+)
+
+// ParseRuntime parse any of the accepted runtime forms
+func ParseRuntime(value string) (Runtime, error) {
+	value = strings.TrimSpace(value)
+
+	if minutes, found := strings.CutSuffix(value, " mins"); found {
+		return runtimeFromParts("", minutes)
+	}
+	if match := runtimeISO8601RX.FindStringSubmatch(strings.ToUpper(value)); match != nil && strings.ToUpper(value) != "PT" {
+		return runtimeFromParts(match[1], match[2])
+	}
+	if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return runtimeFromParts("", value)
+	}
+	if match := runtimeHoursMinutesRX.FindStringSubmatch(strings.ToLower(value)); match != nil && value != "" {
+		return runtimeFromParts(match[1], match[2])
+	}
+	return 0, ErrInvalidRuntimeFormat
+}
+
+// runtimeFromParts add up the hours and minutes, either can be empty
+func runtimeFromParts(hours, minutes string) (Runtime, error) {
+	var total int64
+	for _, part := range []struct {
+		value  string
+		factor int64
+	}{{hours, 60}, {minutes, 1}} {
+		if part.value == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(part.value, 10, 32)
+		if err != nil {
+			return 0, ErrInvalidRuntimeFormat
+		}
+		total += n * part.factor
+	}
+	if total > math.MaxInt32 || total < math.MinInt32 {
+		return 0, ErrInvalidRuntimeFormat
+	}
+	return Runtime(total), nil
+}
+
+// String render the runtime as "<runtime> mins", the form accepted back by
+// UnmarshalJSON, every output format goes through it
+func (r Runtime) String() string {
+	return strconv.FormatInt(int64(r), 10) + " mins"
+}
+
+func (r Runtime) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(r.String())), nil
+}
+
+// UnmarshalJSON accept a JSON number of minutes or a string in any of the
+// forms understood by ParseRuntime
 func (r *Runtime) UnmarshalJSON(jsonValue []byte) error {
-	unquotedJSONValue, err := strconv.Unquote(string(jsonValue))
-	if err != nil {
-		return ErrInvalidRuntimeFormat
+	value := string(jsonValue)
+	if value == "null" {
+		return nil
 	}
-	parts := strings.Split(unquotedJSONValue, " ")
-	if len(parts) != 2 || parts[1] != "mins" {
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		value = unquoted
+	} else if strings.HasPrefix(value, `"`) {
 		return ErrInvalidRuntimeFormat
 	}
 
-	i, err := strconv.ParseInt(parts[0], 10, 32)
+	runtime, err := ParseRuntime(value)
 	if err != nil {
-		return ErrInvalidRuntimeFormat
+		return err
 	}
+	*r = runtime
+	return nil
+}
 
-	*r = Runtime(i)
+func (r Runtime) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *Runtime) UnmarshalText(text []byte) error {
+	runtime, err := ParseRuntime(string(text))
+	if err != nil {
+		return err
+	}
+	*r = runtime
+	return nil
+}
+
+// UnmarshalParam let gin bind query parameters such as runtime_min=1h30m
+func (r *Runtime) UnmarshalParam(param string) error {
+	return r.UnmarshalText([]byte(param))
+}
+
+// Value store the runtime as its number of minutes
+func (r Runtime) Value() (driver.Value, error) {
+	return int64(r), nil
+}
+
+func (r *Runtime) Scan(src any) error {
+	switch value := src.(type) {
+	case nil:
+		*r = 0
+	case int64:
+		if value > math.MaxInt32 || value < math.MinInt32 {
+			return fmt.Errorf("runtime %d out of range", value)
+		}
+		*r = Runtime(value)
+	case []byte:
+		return r.UnmarshalText(value)
+	case string:
+		return r.UnmarshalText([]byte(value))
+	default:
+		return fmt.Errorf("cannot scan %T into a runtime", src)
+	}
 	return nil
 }
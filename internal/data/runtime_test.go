@@ -0,0 +1,51 @@
+package data
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseRuntime(t *testing.T) {
+	tests := map[string]Runtime{
+		"123":      123,
+		"123 mins": 123,
+		"2h 3m":    123,
+		"2h3m":     123,
+		"2h":       120,
+		"45m":      45,
+		"PT2H3M":   123,
+		"pt45m":    45,
+		" 90 ":     90,
+	}
+	for input, want := range tests {
+		got, err := ParseRuntime(input)
+		if err != nil || got != want {
+			t.Errorf("ParseRuntime(%q) = %d, %v; want %d", input, got, err, want)
+		}
+	}
+
+	for _, input := range []string{"", "PT", "mins", "2 hours", "1.5", "PT2H3M4S", "99999999999"} {
+		if _, err := ParseRuntime(input); err == nil {
+			t.Errorf("ParseRuntime(%q): expected an error", input)
+		}
+	}
+}
+
+func TestRuntimeJSONRoundTrip(t *testing.T) {
+	js, err := json.Marshal(Movie{Runtime: 102})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var movie Movie
+	if err = json.Unmarshal(js, &movie); err != nil || movie.Runtime != 102 {
+		t.Errorf("round trip of %s: got %d, %v", js, movie.Runtime, err)
+	}
+
+	for _, input := range []string{`102`, `"102 mins"`, `"1h 42m"`, `"PT1H42M"`} {
+		var r Runtime
+		if err = json.Unmarshal([]byte(input), &r); err != nil || r != 102 {
+			t.Errorf("Unmarshal(%s) = %d, %v", input, r, err)
+		}
+	}
+}
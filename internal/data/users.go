@@ -2,6 +2,7 @@ package data
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
 	"errors"
 	"gin-project/internal/database"
@@ -15,12 +16,20 @@ type User struct {
 	ID        uuid.UUID `json:"id,omitempty"`
 	CreatedAt time.Time `json:"created_at,omitempty"`
 	Username  string    `json:"username"`
-	Password  password  `json:"password"`
+	Password  password  `json:"-"`
 	Email     string    `json:"email"`
 	Activated bool      `json:"activated,omitempty"`
 	Version   int       `json:"-"`
 }
 
+// AnonymousUser represents an unauthenticated client
+var AnonymousUser = &User{}
+
+// IsAnonymous check if the user is the AnonymousUser
+func (u *User) IsAnonymous() bool {
+	return u == AnonymousUser
+}
+
 type password struct {
 	plaintext *string
 	hash      []byte
@@ -60,7 +69,7 @@ func (m *UserModel) GetByEmail(ctx context.Context, email string) (*User, error)
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	query := `SELECT id, created_at, username, password, email, activated, version
+	query := `SELECT id, created_at, user_name, password_hash, email, activated, version
 	FROM users
 	WHERE email = $1`
 
@@ -92,7 +101,7 @@ func (m *UserModel) Update(ctx context.Context, user *User) error {
 	defer cancel()
 
 	query := `UPDATE users
-	SET username = $1, password = $2, email = $3, activated = $4, version = version + 1
+	SET user_name = $1, password_hash = $2, email = $3, activated = $4, version = version + 1
 	WHERE id = $5 AND version = $6
 	RETURNING version`
 
@@ -111,6 +120,45 @@ func (m *UserModel) Update(ctx context.Context, user *User) error {
 	return nil
 }
 
+// GetForToken return the user owning a non-expired token of the given scope
+func (m *UserModel) GetForToken(ctx context.Context, tokenScope, tokenPlaintext string) (*User, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `SELECT users.id, users.created_at, users.user_name, users.password_hash, users.email, users.activated, users.version
+	FROM users
+	INNER JOIN tokens
+	ON users.id = tokens.user_id
+	WHERE tokens.hash = $1
+	AND tokens.scope = $2
+	AND tokens.expiry > $3`
+
+	args := []interface{}{tokenHash[:], tokenScope, time.Now()}
+
+	var user User
+	err := m.service.DB().QueryRowContext(ctx, query, args...).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Username,
+		&user.Password.hash,
+		&user.Email,
+		&user.Activated,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
 func (p *password) Set(plaintextPassword string) error {
 	hash, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), 12)
 	if err != nil {
@@ -0,0 +1,318 @@
+package log
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"regexp"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TracePolicy decide which entries carry a stack trace
+type TracePolicy int8
+
+const (
+	// TraceError record a stack trace for errors and fatal errors
+	TraceError TracePolicy = iota
+	// TraceFatal record a stack trace for fatal errors only
+	TraceFatal
+	// TraceNever never record a stack trace
+	TraceNever
+)
+
+func (p TracePolicy) String() string {
+	switch p {
+	case TraceError:
+		return "error"
+	case TraceFatal:
+		return "fatal"
+	case TraceNever:
+		return "never"
+	default:
+		return ""
+	}
+}
+
+func (p TracePolicy) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText parse a policy name, it lets a policy be set with flag.TextVar
+func (p *TracePolicy) UnmarshalText(text []byte) error {
+	for _, policy := range []TracePolicy{TraceError, TraceFatal, TraceNever} {
+		if strings.EqualFold(string(text), policy.String()) {
+			*p = policy
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown trace policy %q, must be error, fatal or never", text)
+}
+
+func (p TracePolicy) traced(level slog.Level) bool {
+	switch p {
+	case TraceError:
+		return level >= LevelError.Level()
+	case TraceFatal:
+		return level >= LevelFatal.Level()
+	default:
+		return false
+	}
+}
+
+// DefaultRedactKeys are the attribute keys redacted when Options.RedactKeys is nil
+var DefaultRedactKeys = []string{"password", "token", "secret", "authorization", "email"}
+
+const redacted = "[REDACTED]"
+
+type Options struct {
+	Trace TracePolicy
+	// RedactKeys lists the attribute keys whose value is never written, a key
+	// matches when it contains one of them regardless of case. The messages,
+	// the errors and the strings are scrubbed too: the value following a
+	// matching key, as in token=... or the (email)=(...) detail of a postgres
+	// error, and the email addresses when email is one of the keys
+	RedactKeys []string
+}
+
+// Handler is a slog.Handler writing one JSON object per line, with the
+// attributes collected under "properties"
+type Handler struct {
+	out        io.Writer
+	mu         *sync.Mutex
+	level      slog.Leveler
+	trace      TracePolicy
+	redactKeys []string
+	scrubber   *scrubber
+	// properties hold the attributes added with WithAttrs, already resolved
+	properties map[string]any
+	// prefix is the dotted path of the open groups
+	prefix string
+}
+
+func NewHandler(out io.Writer, level slog.Leveler, opts Options) *Handler {
+	redactKeys := opts.RedactKeys
+	if redactKeys == nil {
+		redactKeys = DefaultRedactKeys
+	}
+	lower := make([]string, len(redactKeys))
+	for i, key := range redactKeys {
+		lower[i] = strings.ToLower(key)
+	}
+
+	return &Handler{
+		out:        out,
+		mu:         &sync.Mutex{},
+		level:      level,
+		trace:      opts.Trace,
+		redactKeys: lower,
+		scrubber:   newScrubber(lower),
+	}
+}
+
+func (h *Handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *Handler) Handle(_ context.Context, r slog.Record) error {
+	var properties map[string]any
+	if len(h.properties) > 0 || r.NumAttrs() > 0 {
+		properties = maps.Clone(h.properties)
+		if properties == nil {
+			properties = make(map[string]any, r.NumAttrs())
+		}
+		r.Attrs(func(a slog.Attr) bool {
+			h.addAttr(properties, h.prefix, a)
+			return true
+		})
+	}
+
+	aux := struct {
+		Level      string         `json:"level"`
+		Time       string         `json:"time"`
+		Message    string         `json:"message"`
+		Properties map[string]any `json:"properties,omitempty"`
+		Trace      string         `json:"trace,omitempty"`
+	}{
+		Level:      levelOf(r.Level).String(),
+		Time:       r.Time.UTC().Format(time.RFC3339),
+		Message:    h.scrubber.scrub(r.Message),
+		Properties: properties,
+	}
+
+	if h.trace.traced(r.Level) {
+		aux.Trace = string(debug.Stack())
+	}
+
+	line, err := json.Marshal(aux)
+	if err != nil {
+		line = []byte(LevelError.String() + ": unable to marshal log message: " + err.Error())
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err = writeLevel(h.out, levelOf(r.Level), append(line, '\n'))
+	return err
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	child := *h
+	child.properties = maps.Clone(h.properties)
+	if child.properties == nil {
+		child.properties = make(map[string]any, len(attrs))
+	}
+	for _, a := range attrs {
+		h.addAttr(child.properties, h.prefix, a)
+	}
+	return &child
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	child := *h
+	child.prefix = h.prefix + name + "."
+	return &child
+}
+
+// addAttr add a to properties under its dotted key, the members of a group
+// are flattened and sensitive values are redacted
+func (h *Handler) addAttr(properties map[string]any, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, member := range a.Value.Group() {
+			h.addAttr(properties, prefix, member)
+		}
+		return
+	}
+
+	key := prefix + a.Key
+	if h.sensitive(key) {
+		properties[key] = redacted
+		return
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindDuration:
+		properties[key] = a.Value.Duration().String()
+	case slog.KindTime:
+		properties[key] = a.Value.Time().UTC().Format(time.RFC3339Nano)
+	case slog.KindString:
+		properties[key] = h.scrubber.scrub(a.Value.String())
+	case slog.KindAny:
+		value := a.Value.Any()
+		if err, ok := value.(error); ok {
+			value = h.scrubber.scrub(err.Error())
+		}
+		properties[key] = value
+	default:
+		properties[key] = a.Value.Any()
+	}
+}
+
+func (h *Handler) sensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, redactKey := range h.redactKeys {
+		if strings.Contains(key, redactKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// scrubber redact the sensitive values found in free text, like an error
+// message, where they are not behind an attribute key
+type scrubber struct {
+	// pairs match a key followed by = or : and its value, with the scheme of
+	// an authorization header
+	pairs *regexp.Regexp
+	// details match the (key)=(value) detail of a postgres error
+	details *regexp.Regexp
+	// emails is nil unless email is a redacted key
+	emails     *regexp.Regexp
+	redactKeys []string
+}
+
+var (
+	detailPattern = regexp.MustCompile(`\(([^()]*)\)=\(([^()]*)\)`)
+	emailPattern  = regexp.MustCompile(`[\w.+-]+@[\w-]+(?:\.[\w-]+)+`)
+)
+
+// newScrubber return a scrubber for the lowercased redactKeys, or nil when
+// there is nothing to redact
+func newScrubber(redactKeys []string) *scrubber {
+	quoted := make([]string, 0, len(redactKeys))
+	for _, key := range redactKeys {
+		if key != "" {
+			quoted = append(quoted, regexp.QuoteMeta(key))
+		}
+	}
+	if len(quoted) == 0 {
+		return nil
+	}
+
+	s := &scrubber{
+		pairs:      regexp.MustCompile(`(?i)(\w*(?:` + strings.Join(quoted, "|") + `)\w*\s*[=:]\s*)("[^"]*"|(?:bearer |basic )?[^\s&,;)]+)`),
+		details:    detailPattern,
+		redactKeys: redactKeys,
+	}
+	for _, key := range redactKeys {
+		if key != "" && strings.Contains("email", key) {
+			s.emails = emailPattern
+		}
+	}
+	return s
+}
+
+func (s *scrubber) scrub(text string) string {
+	if s == nil {
+		return text
+	}
+	text = s.details.ReplaceAllStringFunc(text, func(detail string) string {
+		match := s.details.FindStringSubmatch(detail)
+		columns := strings.ToLower(match[1])
+		for _, key := range s.redactKeys {
+			if key != "" && strings.Contains(columns, key) {
+				return "(" + match[1] + ")=(" + redacted + ")"
+			}
+		}
+		return detail
+	})
+	text = s.pairs.ReplaceAllString(text, "${1}"+redacted)
+	if s.emails != nil {
+		text = s.emails.ReplaceAllString(text, redacted)
+	}
+	return text
+}
+
+// levelOf return the closest level of this package to a slog level
+func levelOf(level slog.Level) Level {
+	switch {
+	case level >= LevelFatal.Level():
+		return LevelFatal
+	case level >= LevelError.Level():
+		return LevelError
+	case level >= LevelWarn.Level():
+		return LevelWarn
+	case level >= LevelInfo.Level():
+		return LevelInfo
+	default:
+		return LevelDebug
+	}
+}
@@ -1,18 +1,19 @@
 package log
 
 import (
-	"encoding/json"
+	"context"
+	"fmt"
 	"io"
+	"log/slog"
 	"os"
-	"runtime/debug"
-	"sync"
-	"time"
+	"strings"
 )
 
 type Level int8
 
 const (
-	LevelInfo Level = iota
+	LevelDebug Level = iota - 1
+	LevelInfo
 	LevelWarn
 	LevelError
 	LevelFatal
@@ -20,6 +21,8 @@ const (
 
 func (l Level) String() string {
 	switch l {
+	case LevelDebug:
+		return "DEBUG"
 	case LevelInfo:
 		return "INFO"
 	case LevelWarn:
@@ -33,68 +36,103 @@ func (l Level) String() string {
 	}
 }
 
+// Level return the matching slog level, which makes Level a slog.Leveler
+func (l Level) Level() slog.Level {
+	switch l {
+	case LevelDebug:
+		return slog.LevelDebug
+	case LevelWarn:
+		return slog.LevelWarn
+	case LevelError:
+		return slog.LevelError
+	case LevelFatal:
+		return slog.LevelError + 4
+	default:
+		return slog.LevelInfo
+	}
+}
+
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(strings.ToLower(l.String())), nil
+}
+
+// UnmarshalText parse a level name, it lets a level be set with flag.TextVar
+func (l *Level) UnmarshalText(text []byte) error {
+	for level := LevelDebug; level <= LevelFatal; level++ {
+		if strings.EqualFold(string(text), level.String()) {
+			*l = level
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown log level %q", text)
+}
+
+// Logger write leveled entries through a slog.Handler. Attributes are given as
+// alternating keys and values or as slog.Attr, like with slog.Logger, and the
+// loggers derived with With share the minimum level of their parent.
 type Logger struct {
-	out      io.Writer
-	minLevel Level
-	mu       sync.Mutex
+	logger *slog.Logger
+	level  *slog.LevelVar
 }
 
+// New return a logger writing JSON lines to out with the default options
 func New(out io.Writer, minLevel Level) *Logger {
+	return NewWithOptions(out, minLevel, Options{})
+}
+
+func NewWithOptions(out io.Writer, minLevel Level, opts Options) *Logger {
+	level := &slog.LevelVar{}
+	level.Set(minLevel.Level())
 	return &Logger{
-		out:      out,
-		minLevel: minLevel,
+		logger: slog.New(NewHandler(out, level, opts)),
+		level:  level,
 	}
 }
 
-func (l *Logger) PrintInfo(message string, properties map[string]string) {
-	l.print(LevelInfo, message, properties)
+// SetLevel change the minimum level of the logger and of every logger derived
+// from it, it is safe to call while the logger is in use
+func (l *Logger) SetLevel(level Level) {
+	l.level.Set(level.Level())
 }
 
-func (l *Logger) PrintWarn(message string, properties map[string]string) {
-	l.print(LevelWarn, message, properties)
+// MinLevel return the current minimum level
+func (l *Logger) MinLevel() Level {
+	return levelOf(l.level.Level())
 }
 
-func (l *Logger) PrintError(err error, properties map[string]string) {
-	l.print(LevelError, err.Error(), properties)
+// With return a child logger adding args to every entry
+func (l *Logger) With(args ...any) *Logger {
+	return &Logger{logger: l.logger.With(args...), level: l.level}
 }
 
-func (l *Logger) PrintFatal(err error, properties map[string]string) {
-	l.print(LevelFatal, err.Error(), properties)
-	os.Exit(1)
+// Slog return the underlying slog.Logger, for libraries expecting one
+func (l *Logger) Slog() *slog.Logger {
+	return l.logger
 }
 
-func (l *Logger) print(level Level, message string, properties map[string]string) (int, error) {
-	if level < l.minLevel {
-		return 0, nil
-	}
+func (l *Logger) Debug(message string, args ...any) {
+	l.logger.Log(context.Background(), LevelDebug.Level(), message, args...)
+}
 
-	aux := struct {
-		Level      string            `json:"level"`
-		Time       string            `json:"time"`
-		Message    string            `json:"message"`
-		Properties map[string]string `json:"properties,omitempty"`
-		Trace      string            `json:"trace,omitempty"`
-	}{
-		Level:      level.String(),
-		Time:       time.Now().UTC().Format(time.RFC3339),
-		Message:    message,
-		Properties: properties,
-	}
+func (l *Logger) Info(message string, args ...any) {
+	l.logger.Log(context.Background(), LevelInfo.Level(), message, args...)
+}
 
-	if level >= LevelError {
-		aux.Trace = string(debug.Stack())
-	}
+func (l *Logger) Warn(message string, args ...any) {
+	l.logger.Log(context.Background(), LevelWarn.Level(), message, args...)
+}
 
-	line, err := json.Marshal(aux)
-	if err != nil {
-		line = []byte(LevelError.String() + ": unable to marshal log message: " + err.Error())
-	}
+func (l *Logger) Error(err error, args ...any) {
+	l.logger.Log(context.Background(), LevelError.Level(), err.Error(), args...)
+}
 
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	return l.out.Write(append(line, '\n'))
+func (l *Logger) Fatal(err error, args ...any) {
+	l.logger.Log(context.Background(), LevelFatal.Level(), err.Error(), args...)
+	os.Exit(1)
 }
 
+// Write log message as an error, it lets the logger back a standard log.Logger
 func (l *Logger) Write(message []byte) (n int, err error) {
-	return l.print(LevelError, string(message), nil)
+	l.logger.Log(context.Background(), LevelError.Level(), strings.TrimSuffix(string(message), "\n"))
+	return len(message), nil
 }
@@ -0,0 +1,167 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+type entry struct {
+	Level      string         `json:"level"`
+	Message    string         `json:"message"`
+	Properties map[string]any `json:"properties"`
+	Trace      string         `json:"trace"`
+}
+
+func readEntries(t *testing.T, out *bytes.Buffer) []entry {
+	t.Helper()
+	var entries []entry
+	for _, line := range bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var e entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			t.Fatalf("invalid log line %q: %v", line, err)
+		}
+		entries = append(entries, e)
+	}
+	out.Reset()
+	return entries
+}
+
+func TestLogger(t *testing.T) {
+	var out bytes.Buffer
+	l := New(&out, LevelInfo)
+	child := l.With("request_id", "abc", slog.Group("user", "id", 7, "email", "bob@example.com"))
+
+	child.Info("access", "status", 200, "latency", 1500*time.Millisecond, "password", "pa55word", "ok", true)
+	child.Debug("hidden")
+	entries := readEntries(t, &out)
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	want := map[string]any{
+		"request_id": "abc",
+		"user.id":    7.0,
+		"user.email": redacted,
+		"status":     200.0,
+		"latency":    "1.5s",
+		"password":   redacted,
+		"ok":         true,
+	}
+	got := entries[0]
+	if got.Level != "INFO" || got.Message != "access" || got.Trace != "" {
+		t.Errorf("unexpected entry %+v", got)
+	}
+	for key, value := range want {
+		if got.Properties[key] != value {
+			t.Errorf("property %q = %v, want %v", key, got.Properties[key], value)
+		}
+	}
+
+	// the children share the level of their parent
+	l.SetLevel(LevelDebug)
+	child.Debug("shown")
+	if entries := readEntries(t, &out); len(entries) != 1 || entries[0].Level != "DEBUG" {
+		t.Errorf("expected a debug entry after SetLevel, got %+v", entries)
+	}
+	if l.MinLevel() != LevelDebug {
+		t.Errorf("MinLevel() = %v, want %v", l.MinLevel(), LevelDebug)
+	}
+
+	l.Error(errors.New("boom"), "auth_token", "secret")
+	entries = readEntries(t, &out)
+	if len(entries) != 1 || entries[0].Message != "boom" || entries[0].Trace == "" || entries[0].Properties["auth_token"] != redacted {
+		t.Errorf("unexpected error entry %+v", entries)
+	}
+}
+
+func TestTracePolicy(t *testing.T) {
+	var out bytes.Buffer
+	l := NewWithOptions(&out, LevelInfo, Options{Trace: TraceNever, RedactKeys: []string{}})
+
+	l.Error(errors.New("boom"), "password", "pa55word")
+	entries := readEntries(t, &out)
+	if len(entries) != 1 || entries[0].Trace != "" || entries[0].Properties["password"] != "pa55word" {
+		t.Errorf("unexpected entry %+v", entries)
+	}
+
+	var policy TracePolicy
+	if err := policy.UnmarshalText([]byte("Fatal")); err != nil || policy != TraceFatal {
+		t.Errorf("UnmarshalText(Fatal) = %v, %v", policy, err)
+	}
+	if err := policy.UnmarshalText([]byte("sometimes")); err == nil {
+		t.Error("expected an error for an unknown policy")
+	}
+}
+
+func TestLevelUnmarshalText(t *testing.T) {
+	for _, level := range []Level{LevelDebug, LevelInfo, LevelWarn, LevelError, LevelFatal} {
+		text, _ := level.MarshalText()
+		var got Level
+		if err := got.UnmarshalText(text); err != nil || got != level {
+			t.Errorf("UnmarshalText(%s) = %v, %v", text, got, err)
+		}
+		if levelOf(level.Level()) != level {
+			t.Errorf("levelOf(%v) = %v", level.Level(), levelOf(level.Level()))
+		}
+	}
+	var level Level
+	if err := level.UnmarshalText([]byte("verbose")); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+}
+
+func TestScrub(t *testing.T) {
+	var out bytes.Buffer
+	l := New(&out, LevelInfo)
+
+	err := fmt.Errorf("inserting user: %w", errors.New(`duplicate key value violates unique constraint "users_email_key": Key (email)=(bob@example.com) already exists`))
+	l.Error(err, "cause", err, "uri", "/v1/users/activated?token=abc123&x=1", "name", "Bob")
+	entries := readEntries(t, &out)
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	want := `inserting user: duplicate key value violates unique constraint "users_email_key": Key (email)=([REDACTED]) already exists`
+	if entries[0].Message != want {
+		t.Errorf("message = %q, want %q", entries[0].Message, want)
+	}
+	if entries[0].Properties["cause"] != want {
+		t.Errorf("cause = %q, want %q", entries[0].Properties["cause"], want)
+	}
+	if got := entries[0].Properties["uri"]; got != "/v1/users/activated?token=[REDACTED]&x=1" {
+		t.Errorf("uri = %q", got)
+	}
+	if got := entries[0].Properties["name"]; got != "Bob" {
+		t.Errorf("name = %q", got)
+	}
+
+	tests := []struct {
+		text string
+		want string
+	}{
+		{`login failed for alice@example.org`, `login failed for [REDACTED]`},
+		{`connect: password="s3 cret" host=db`, `connect: password=[REDACTED] host=db`},
+		{`Authorization: Bearer xyz`, `Authorization: [REDACTED]`},
+		{`Key (movie_id, user_id)=(1, 2) already exists`, `Key (movie_id, user_id)=(1, 2) already exists`},
+		{`no secrets here`, `no secrets here`},
+	}
+	for _, tt := range tests {
+		l.Info(tt.text)
+		if entries := readEntries(t, &out); len(entries) != 1 || entries[0].Message != tt.want {
+			t.Errorf("scrubbing %q gave %+v, want %q", tt.text, entries, tt.want)
+		}
+	}
+
+	// the scrubbing follows the redact keys
+	l = NewWithOptions(&out, LevelInfo, Options{RedactKeys: []string{}})
+	l.Info("token=abc bob@example.com")
+	if entries := readEntries(t, &out); len(entries) != 1 || entries[0].Message != "token=abc bob@example.com" {
+		t.Errorf("expected no scrubbing without redact keys, got %+v", entries)
+	}
+}
@@ -0,0 +1,354 @@
+package log
+
+import (
+	"cmp"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is the timestamp inserted in the name of a rotated segment,
+// it sorts in chronological order
+const backupTimeFormat = "20060102T150405.000"
+
+type RotateOptions struct {
+	// MaxSize rotate the file before it grows past this many bytes, 0 disables
+	// the size based rotation
+	MaxSize int64
+	// Interval rotate the file once it has been written to for this long, 0
+	// disables the time based rotation
+	Interval time.Duration
+	// MaxBackups is the number of rotated segments kept, 0 keeps them all
+	MaxBackups int
+	// MaxAge remove the rotated segments older than this, 0 keeps them all
+	MaxAge time.Duration
+	// Compress gzip the rotated segments
+	Compress bool
+}
+
+// RotatingFile is a log file rotated by size and/or age. The rotated segments
+// are renamed after the time of the rotation, app.log becoming
+// app-20240102T150405.000.log, or app-20240102T150405.000-1.log when that name
+// is taken, then compressed and pruned in the background.
+type RotatingFile struct {
+	path string
+	opts RotateOptions
+	now  func() time.Time
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+
+	// cleanupMu serialize the compression and pruning of the segments
+	cleanupMu sync.Mutex
+	wg        sync.WaitGroup
+}
+
+func OpenRotatingFile(path string, opts RotateOptions) (*RotatingFile, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &RotatingFile{path: path, opts: opts, now: time.Now}
+	err = f.open()
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = info.Size()
+	f.openedAt = f.now()
+	return nil
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.due(len(p)) {
+		err := f.rotate()
+		if err != nil {
+			// a failed rotation keeps the current segment, the entry is
+			// written to it and the rotation is retried once the segment is
+			// due again
+			fmt.Fprintf(os.Stderr, "log: rotate %s: %v\n", f.path, err)
+			f.size = 0
+			f.openedAt = f.now()
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// due report whether the file must be rotated before writing n more bytes, an
+// empty file is never rotated
+func (f *RotatingFile) due(n int) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.opts.MaxSize > 0 && f.size+int64(n) > f.opts.MaxSize {
+		return true
+	}
+	return f.opts.Interval > 0 && f.now().Sub(f.openedAt) >= f.opts.Interval
+}
+
+// Rotate close the current segment and start a new one
+func (f *RotatingFile) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return os.ErrClosed
+	}
+	return f.rotate()
+}
+
+// rotate rename the current segment while it is still open and start a new
+// one, on failure the current segment is left in place and stays open
+func (f *RotatingFile) rotate() error {
+	backup, err := f.backupName()
+	if err != nil {
+		return err
+	}
+	err = os.Rename(f.path, backup)
+	if err != nil {
+		return err
+	}
+
+	current := f.file
+	err = f.open()
+	if err != nil {
+		// put the segment back so that the next rotation finds it
+		if renameErr := os.Rename(backup, f.path); renameErr != nil {
+			return errors.Join(err, renameErr)
+		}
+		return err
+	}
+	err = current.Close()
+
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		f.cleanup(backup)
+	}()
+	return err
+}
+
+// backupName return a name for the segment being rotated which is not used by
+// another segment, a counter is appended to the time of the rotation when
+// several rotations happen within the same millisecond
+func (f *RotatingFile) backupName() (string, error) {
+	prefix, ext := f.backupAffixes()
+	base := filepath.Join(filepath.Dir(f.path), prefix+f.now().UTC().Format(backupTimeFormat))
+
+	for seq := 0; ; seq++ {
+		name := base + ext
+		if seq > 0 {
+			name = base + "-" + strconv.Itoa(seq) + ext
+		}
+		taken, err := exists(name)
+		if err == nil && !taken {
+			taken, err = exists(name + ".gz")
+		}
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return name, nil
+		}
+	}
+}
+
+func exists(name string) (bool, error) {
+	_, err := os.Lstat(name)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// cleanup compress the segment which was just rotated and remove the segments
+// past the retention, the errors are reported on stderr as the file cannot
+// log about itself
+func (f *RotatingFile) cleanup(backup string) {
+	f.cleanupMu.Lock()
+	defer f.cleanupMu.Unlock()
+
+	if f.opts.Compress {
+		// the segment may already be pruned by the cleanup of a later one
+		err := compressFile(backup)
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "log: compress %s: %v\n", backup, err)
+		}
+	}
+
+	err := f.prune()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "log: prune %s: %v\n", f.path, err)
+	}
+}
+
+func compressFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(name+".gz.tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(dst.Name())
+
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if err == nil {
+		err = zw.Close()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(dst.Name(), name+".gz")
+	if err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
+
+// Backups return the rotated segments of the file, newest first
+func (f *RotatingFile) Backups() ([]string, error) {
+	dir := filepath.Dir(f.path)
+	prefix, ext := f.backupAffixes()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	type segment struct {
+		name string
+		t    time.Time
+		seq  int
+	}
+	var segments []segment
+	for _, entry := range entries {
+		if t, seq, ok := parseBackup(entry.Name(), prefix, ext); ok && !entry.IsDir() {
+			segments = append(segments, segment{filepath.Join(dir, entry.Name()), t, seq})
+		}
+	}
+	slices.SortFunc(segments, func(a, b segment) int {
+		if c := b.t.Compare(a.t); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.seq, a.seq)
+	})
+
+	backups := make([]string, len(segments))
+	for i, segment := range segments {
+		backups[i] = segment.name
+	}
+	return backups, nil
+}
+
+// backupAffixes return the prefix and the extension shared by the names of the
+// rotated segments
+func (f *RotatingFile) backupAffixes() (prefix, ext string) {
+	ext = filepath.Ext(f.path)
+	return strings.TrimSuffix(filepath.Base(f.path), ext) + "-", ext
+}
+
+// parseBackup parse the rotation time and the counter out of the name of a
+// segment
+func parseBackup(name, prefix, ext string) (time.Time, int, bool) {
+	stamp, ok := strings.CutPrefix(name, prefix)
+	if !ok {
+		return time.Time{}, 0, false
+	}
+	stamp, ok = strings.CutSuffix(strings.TrimSuffix(stamp, ".gz"), ext)
+	if !ok {
+		return time.Time{}, 0, false
+	}
+
+	seq := 0
+	stamp, counter, found := strings.Cut(stamp, "-")
+	if found {
+		n, err := strconv.Atoi(counter)
+		if err != nil || n <= 0 {
+			return time.Time{}, 0, false
+		}
+		seq = n
+	}
+	t, err := time.Parse(backupTimeFormat, stamp)
+	return t, seq, err == nil
+}
+
+func (f *RotatingFile) prune() error {
+	if f.opts.MaxBackups <= 0 && f.opts.MaxAge <= 0 {
+		return nil
+	}
+
+	backups, err := f.Backups()
+	if err != nil {
+		return err
+	}
+
+	prefix, ext := f.backupAffixes()
+	for i, backup := range backups {
+		t, _, _ := parseBackup(filepath.Base(backup), prefix, ext)
+		expired := f.opts.MaxAge > 0 && f.now().Sub(t) > f.opts.MaxAge
+		if expired || (f.opts.MaxBackups > 0 && i >= f.opts.MaxBackups) {
+			err := os.Remove(backup)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close close the file and wait for the pending compressions
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	var err error
+	if f.file != nil {
+		err = f.file.Close()
+		f.file = nil
+	}
+	f.mu.Unlock()
+
+	f.wg.Wait()
+	return err
+}
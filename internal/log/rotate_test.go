@@ -0,0 +1,167 @@
+package log
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api.log")
+	f, err := OpenRotatingFile(path, RotateOptions{MaxSize: 10, Interval: time.Hour, MaxBackups: 2, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	f.now = func() time.Time { return now }
+	f.openedAt = now
+
+	write := func(line string) {
+		t.Helper()
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(time.Second)
+	}
+
+	// the second and third lines would push the file past MaxSize
+	write("line 1\n")
+	write("line 2\n")
+	write("line 3\n")
+	// small enough for MaxSize, rotated because the segment is an hour old
+	now = now.Add(time.Hour)
+	write("4\n")
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	current, err := os.ReadFile(path)
+	if err != nil || string(current) != "4\n" {
+		t.Fatalf("unexpected current segment %q, %v", current, err)
+	}
+
+	backups, err := f.Backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// three rotations, the oldest segment is pruned by MaxBackups
+	want := []string{"api-20240102T160408.000.log.gz", "api-20240102T150407.000.log.gz"}
+	if len(backups) != len(want) {
+		t.Fatalf("unexpected backups %v", backups)
+	}
+	for i, backup := range backups {
+		if filepath.Base(backup) != want[i] {
+			t.Errorf("backup %d = %s, want %s", i, filepath.Base(backup), want[i])
+		}
+	}
+
+	gz, err := os.Open(backups[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gz.Close()
+	zr, err := gzip.NewReader(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := io.ReadAll(zr)
+	if err != nil || string(content) != "line 2\n" {
+		t.Errorf("unexpected backup content %q, %v", content, err)
+	}
+}
+
+func TestRotatingFileMaxAge(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "api.log")
+	old := filepath.Join(dir, "api-20240101T000000.000.log.gz")
+	other := filepath.Join(dir, "other-20240101T000000.000.log")
+	for _, name := range []string{old, other} {
+		if err := os.WriteFile(name, []byte("old\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := OpenRotatingFile(path, RotateOptions{MaxAge: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.now = func() time.Time { return time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC) }
+	f.Write([]byte("line\n"))
+	if err := f.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Error("expected the expired segment to be removed")
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Error("expected the files of another log to be left alone")
+	}
+	backups, _ := f.Backups()
+	if len(backups) != 1 || !strings.HasSuffix(backups[0], "api-20240105T000000.000.log") {
+		t.Errorf("unexpected backups %v", backups)
+	}
+}
+
+func TestRotatingFileSameMillisecond(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api.log")
+	f, err := OpenRotatingFile(path, RotateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.now = func() time.Time { return time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC) }
+
+	for _, line := range []string{"1\n", "2\n", "3\n"} {
+		f.Write([]byte(line))
+		if err := f.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.Close()
+
+	// no segment overwrites another, the newest comes first
+	backups, _ := f.Backups()
+	want := []string{"api-20240102T150405.000-2.log", "api-20240102T150405.000-1.log", "api-20240102T150405.000.log"}
+	if len(backups) != len(want) {
+		t.Fatalf("unexpected backups %v", backups)
+	}
+	for i, backup := range backups {
+		content, _ := os.ReadFile(backup)
+		if filepath.Base(backup) != want[i] || string(content) != string(rune('3'-i))+"\n" {
+			t.Errorf("backup %d = %s with %q, want %s", i, filepath.Base(backup), content, want[i])
+		}
+	}
+}
+
+func TestRotatingFileFailedRotation(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs")
+	path := filepath.Join(dir, "api.log")
+	f, err := OpenRotatingFile(path, RotateOptions{MaxSize: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	f.Write([]byte("1\n"))
+	// the segment cannot be renamed once its directory is gone
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Rotate(); err == nil {
+		t.Fatal("expected the rotation to fail")
+	}
+
+	// the current segment is kept open and the entries are not lost
+	for _, line := range []string{"2\n", "3\n"} {
+		if n, err := f.Write([]byte(line)); n != len(line) || err != nil {
+			t.Errorf("Write(%q) = %d, %v after a failed rotation", line, n, err)
+		}
+	}
+}
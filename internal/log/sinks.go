@@ -0,0 +1,150 @@
+package log
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// LevelWriter is implemented by the sinks which route entries by level, the
+// Handler calls WriteLevel rather than Write when its output implements it
+type LevelWriter interface {
+	io.Writer
+	WriteLevel(level Level, p []byte) (int, error)
+}
+
+func writeLevel(out io.Writer, level Level, p []byte) (int, error) {
+	if lw, ok := out.(LevelWriter); ok {
+		return lw.WriteLevel(level, p)
+	}
+	return out.Write(p)
+}
+
+// Output is a destination of a MultiWriter, it receives the entries at or
+// above MinLevel. The zero MinLevel is LevelInfo, use LevelDebug to receive
+// every entry.
+type Output struct {
+	Writer   io.Writer
+	MinLevel Level
+}
+
+// MultiWriter fan out every entry to several outputs. Unlike io.MultiWriter a
+// failing output does not stop the entry from reaching the others.
+type MultiWriter struct {
+	outputs []Output
+}
+
+func NewMultiWriter(outputs ...Output) *MultiWriter {
+	return &MultiWriter{outputs: outputs}
+}
+
+// Write send p to every output, it is used for the entries without a level
+func (m *MultiWriter) Write(p []byte) (int, error) {
+	var errs []error
+	for _, o := range m.outputs {
+		_, err := o.Writer.Write(p)
+		errs = append(errs, err)
+	}
+	return len(p), errors.Join(errs...)
+}
+
+func (m *MultiWriter) WriteLevel(level Level, p []byte) (int, error) {
+	var errs []error
+	for _, o := range m.outputs {
+		if level < o.MinLevel {
+			continue
+		}
+		_, err := writeLevel(o.Writer, level, p)
+		errs = append(errs, err)
+	}
+	return len(p), errors.Join(errs...)
+}
+
+// AsyncWriter queue the entries in a buffer drained by a goroutine, so that
+// logging never waits for a slow output. Entries written while the buffer is
+// full are dropped and counted.
+type AsyncWriter struct {
+	out     io.Writer
+	entries chan asyncEntry
+	dropped atomic.Uint64
+	// mu guards closed, so that no entry is queued once the channel is closed
+	mu     sync.RWMutex
+	closed bool
+	done   chan struct{}
+}
+
+type asyncEntry struct {
+	level   Level
+	leveled bool
+	p       []byte
+}
+
+// NewAsyncWriter return a writer buffering up to size entries for out, Close
+// must be called to flush them
+func NewAsyncWriter(out io.Writer, size int) *AsyncWriter {
+	w := &AsyncWriter{
+		out:     out,
+		entries: make(chan asyncEntry, size),
+		done:    make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+func (w *AsyncWriter) run() {
+	defer close(w.done)
+	for e := range w.entries {
+		if e.leveled {
+			_, _ = writeLevel(w.out, e.level, e.p)
+		} else {
+			_, _ = w.out.Write(e.p)
+		}
+	}
+}
+
+func (w *AsyncWriter) Write(p []byte) (int, error) {
+	return w.enqueue(asyncEntry{p: p})
+}
+
+func (w *AsyncWriter) WriteLevel(level Level, p []byte) (int, error) {
+	return w.enqueue(asyncEntry{level: level, leveled: true, p: p})
+}
+
+func (w *AsyncWriter) enqueue(e asyncEntry) (int, error) {
+	n := len(e.p)
+	// the caller may reuse p once Write returns
+	e.p = append([]byte(nil), e.p...)
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+	select {
+	case w.entries <- e:
+	default:
+		w.dropped.Add(1)
+	}
+	return n, nil
+}
+
+// Dropped return the number of entries dropped because the buffer was full
+func (w *AsyncWriter) Dropped() uint64 {
+	return w.dropped.Load()
+}
+
+// Close stop accepting entries and wait for the queued ones to be written, it
+// does not close the underlying writer
+func (w *AsyncWriter) Close() error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.entries)
+	}
+	w.mu.Unlock()
+
+	<-w.done
+	return nil
+}
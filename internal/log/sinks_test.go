@@ -0,0 +1,80 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestMultiWriter(t *testing.T) {
+	var all, errs bytes.Buffer
+	out := NewMultiWriter(
+		Output{Writer: failingWriter{}, MinLevel: LevelDebug},
+		Output{Writer: &all, MinLevel: LevelDebug},
+		Output{Writer: &errs, MinLevel: LevelError},
+	)
+	l := New(out, LevelDebug)
+
+	l.Debug("starting")
+	l.Error(errors.New("boom"))
+
+	// the failing output does not stop the others
+	if n := strings.Count(all.String(), "\n"); n != 2 {
+		t.Errorf("expected 2 entries in the first output, got %d", n)
+	}
+	if n := strings.Count(errs.String(), "\n"); n != 1 || !strings.Contains(errs.String(), "boom") {
+		t.Errorf("expected only the error in the error output, got %q", errs.String())
+	}
+}
+
+// blockingWriter hold every write until release is closed
+type blockingWriter struct {
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+	mu      sync.Mutex
+	lines   []string
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() { close(w.started) })
+	<-w.release
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lines = append(w.lines, string(p))
+	return len(p), nil
+}
+
+func TestAsyncWriter(t *testing.T) {
+	out := &blockingWriter{started: make(chan struct{}), release: make(chan struct{})}
+	w := NewAsyncWriter(out, 1)
+
+	buf := []byte("first\n")
+	w.Write(buf)
+	<-out.started
+	// the writer copies the entry, the caller may reuse its buffer
+	copy(buf, "reuse")
+	w.Write([]byte("second\n"))
+	w.Write([]byte("third\n"))
+
+	if w.Dropped() != 1 {
+		t.Errorf("Dropped() = %d, want 1", w.Dropped())
+	}
+
+	close(out.release)
+	w.Close()
+	if got := strings.Join(out.lines, ""); got != "first\nsecond\n" {
+		t.Errorf("unexpected output %q", got)
+	}
+	if _, err := w.Write([]byte("late\n")); err == nil {
+		t.Error("expected an error writing to a closed writer")
+	}
+}
@@ -0,0 +1,69 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// MemoryMailer keep rendered emails in memory, it is meant for tests
+type MemoryMailer struct {
+	sender   string
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemory(sender string) *MemoryMailer {
+	return &MemoryMailer{sender: sender}
+}
+
+func (m *MemoryMailer) Send(recipient, templateFile string, data any) error {
+	msg, err := render(m.sender, recipient, templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, *msg)
+	return nil
+}
+
+// Messages return a copy of every email sent so far
+func (m *MemoryMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
+
+// FileMailer write each email as an .eml file in a directory, it stands in for
+// an SMTP server during local development
+type FileMailer struct {
+	dir    string
+	sender string
+}
+
+func NewFile(dir, sender string) (*FileMailer, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	return &FileMailer{dir: dir, sender: sender}, nil
+}
+
+func (m *FileMailer) Send(recipient, templateFile string, data any) error {
+	msg, err := render(m.sender, recipient, templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	body, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d-%s.eml", msg.Date.UnixNano(), strings.NewReplacer("@", "_at_", "/", "_").Replace(recipient))
+	return os.WriteFile(filepath.Join(m.dir, name), body, 0o644)
+}
@@ -0,0 +1,83 @@
+package mailer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryMailerRendersTemplates(t *testing.T) {
+	m := NewMemory("Movies <no-reply@movies.local>")
+	data := map[string]any{
+		"activationToken": "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+		"userID":          "42",
+		"username":        "<alice>",
+	}
+	if err := m.Send("alice@example.com", "user_welcome.tmpl", data); err != nil {
+		t.Fatalf("Send() returned error: %v", err)
+	}
+
+	messages := m.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(messages))
+	}
+	msg := messages[0]
+	if msg.Subject != "Welcome to Movies!" {
+		t.Errorf("unexpected subject %q", msg.Subject)
+	}
+	if !strings.Contains(msg.PlainBody, "Hi <alice>,") {
+		t.Errorf("plain body should contain the raw username, got %q", msg.PlainBody)
+	}
+	if !strings.Contains(msg.HTMLBody, "Hi &lt;alice&gt;,") {
+		t.Errorf("html body should escape the username, got %q", msg.HTMLBody)
+	}
+}
+
+func TestFileMailerWritesEml(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewFile(dir, "no-reply@movies.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Send("bob@example.com", "user_welcome.tmpl", map[string]any{}); err != nil {
+		t.Fatalf("Send() returned error: %v", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected 1 eml file, got %v (%v)", files, err)
+	}
+	content, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "To: bob@example.com\r\n") {
+		t.Errorf("missing To header in %q", content)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	calls := 0
+	err := retry(3, time.Millisecond, func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("temporary failure")
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("expected success after 3 calls, got %v after %d calls", err, calls)
+	}
+
+	calls = 0
+	err = retry(2, time.Millisecond, func() error {
+		calls++
+		return errors.New("permanent failure")
+	})
+	if err == nil || calls != 2 {
+		t.Errorf("expected failure after 2 calls, got %v after %d calls", err, calls)
+	}
+}
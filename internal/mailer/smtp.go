@@ -0,0 +1,46 @@
+package mailer
+
+import (
+	"fmt"
+	"net/smtp"
+	"time"
+)
+
+// SMTPMailer deliver emails through an SMTP server
+type SMTPMailer struct {
+	addr     string
+	auth     smtp.Auth
+	sender   string
+	attempts int
+	backoff  time.Duration
+}
+
+func NewSMTP(host string, port int, username, password, sender string) *SMTPMailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &SMTPMailer{
+		addr:     fmt.Sprintf("%s:%d", host, port),
+		auth:     auth,
+		sender:   sender,
+		attempts: 3,
+		backoff:  500 * time.Millisecond,
+	}
+}
+
+func (m *SMTPMailer) Send(recipient, templateFile string, data any) error {
+	msg, err := render(m.sender, recipient, templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	body, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	return retry(m.attempts, m.backoff, func() error {
+		return smtp.SendMail(m.addr, m.auth, m.sender, []string{recipient}, body)
+	})
+}
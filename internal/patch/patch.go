@@ -0,0 +1,345 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidPointer = errors.New("invalid JSON pointer")
+	ErrPathNotFound   = errors.New("path not found")
+	ErrMissingValue   = errors.New("value must be provided")
+	ErrUnknownOp      = errors.New("unknown operation")
+	ErrTestFailed     = errors.New("test operation failed")
+)
+
+// Operation is a single JSON Patch (RFC 6902) operation
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// OperationError report which operation of a JSON Patch document failed
+type OperationError struct {
+	Index int
+	Op    Operation
+	Err   error
+}
+
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("operation %d (%s %s): %s", e.Index, e.Op.Op, e.Op.Path, e.Err)
+}
+
+func (e *OperationError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeOperations parse a JSON Patch document
+func DecodeOperations(body []byte) ([]Operation, error) {
+	var ops []Operation
+	err := json.Unmarshal(body, &ops)
+	if err != nil {
+		return nil, err
+	}
+	return ops, nil
+}
+
+// Apply run the JSON Patch operations against the JSON document, the operations
+// are atomic so no document is returned if any of them fails
+func Apply(doc []byte, ops []Operation) ([]byte, error) {
+	var node any
+	err := json.Unmarshal(doc, &node)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, op := range ops {
+		node, err = applyOperation(node, op)
+		if err != nil {
+			return nil, &OperationError{Index: i, Op: op, Err: err}
+		}
+	}
+
+	return json.Marshal(node)
+}
+
+// Merge apply a JSON Merge Patch (RFC 7396) to the JSON document
+func Merge(doc, mergePatch []byte) ([]byte, error) {
+	var target, patch any
+	err := json.Unmarshal(doc, &target)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(mergePatch, &patch)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(merge(target, patch))
+}
+
+func merge(target, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]any)
+	if !ok {
+		targetObject = make(map[string]any)
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = merge(targetObject[key], value)
+	}
+	return targetObject
+}
+
+func applyOperation(node any, op Operation) (any, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add":
+		value, err := decodeValue(op.Value)
+		if err != nil {
+			return nil, err
+		}
+		return add(node, path, value)
+	case "remove":
+		node, _, err = remove(node, path)
+		return node, err
+	case "replace":
+		value, err := decodeValue(op.Value)
+		if err != nil {
+			return nil, err
+		}
+		if len(path) == 0 {
+			return value, nil
+		}
+		node, _, err = remove(node, path)
+		if err != nil {
+			return nil, err
+		}
+		return add(node, path, value)
+	case "move":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(op.Path, op.From+"/") {
+			return nil, fmt.Errorf("%w: cannot move a value into one of its children", ErrInvalidPointer)
+		}
+		node, value, err := remove(node, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(node, path, value)
+	case "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := get(node, from)
+		if err != nil {
+			return nil, err
+		}
+		value, err = deepCopy(value)
+		if err != nil {
+			return nil, err
+		}
+		return add(node, path, value)
+	case "test":
+		expected, err := decodeValue(op.Value)
+		if err != nil {
+			return nil, err
+		}
+		actual, err := get(node, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(expected, actual) {
+			return nil, ErrTestFailed
+		}
+		return node, nil
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnknownOp, op.Op)
+	}
+}
+
+// parsePointer split a JSON Pointer (RFC 6901) into its unescaped reference tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w %q", ErrInvalidPointer, pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(tokens[i])
+	}
+	return tokens, nil
+}
+
+func decodeValue(raw json.RawMessage) (any, error) {
+	if len(raw) == 0 {
+		return nil, ErrMissingValue
+	}
+	var value any
+	err := json.Unmarshal(raw, &value)
+	return value, err
+}
+
+func deepCopy(value any) (any, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return decodeValue(raw)
+}
+
+// arrayIndex parse an array reference token, "-" is only accepted when allowEnd is set
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if allowEnd && token == "-" {
+		return length, nil
+	}
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%w: invalid array index %q", ErrInvalidPointer, token)
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid array index %q", ErrInvalidPointer, token)
+	}
+	upper := length - 1
+	if allowEnd {
+		upper = length
+	}
+	if index < 0 || index > upper {
+		return 0, fmt.Errorf("%w: array index %d out of bounds", ErrPathNotFound, index)
+	}
+	return index, nil
+}
+
+func get(node any, path []string) (any, error) {
+	for _, token := range path {
+		switch current := node.(type) {
+		case map[string]any:
+			value, ok := current[token]
+			if !ok {
+				return nil, ErrPathNotFound
+			}
+			node = value
+		case []any:
+			index, err := arrayIndex(token, len(current), false)
+			if err != nil {
+				return nil, err
+			}
+			node = current[index]
+		default:
+			return nil, ErrPathNotFound
+		}
+	}
+	return node, nil
+}
+
+// add insert value at path and return the updated node, slices may be reallocated
+func add(node any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	token := path[0]
+
+	switch current := node.(type) {
+	case map[string]any:
+		if len(path) == 1 {
+			current[token] = value
+			return current, nil
+		}
+		child, ok := current[token]
+		if !ok {
+			return nil, ErrPathNotFound
+		}
+		child, err := add(child, path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		current[token] = child
+		return current, nil
+	case []any:
+		if len(path) == 1 {
+			index, err := arrayIndex(token, len(current), true)
+			if err != nil {
+				return nil, err
+			}
+			current = append(current, nil)
+			copy(current[index+1:], current[index:])
+			current[index] = value
+			return current, nil
+		}
+		index, err := arrayIndex(token, len(current), false)
+		if err != nil {
+			return nil, err
+		}
+		child, err := add(current[index], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		current[index] = child
+		return current, nil
+	default:
+		return nil, ErrPathNotFound
+	}
+}
+
+// remove delete the value at path and return the updated node and the removed value
+func remove(node any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("%w: cannot remove the whole document", ErrInvalidPointer)
+	}
+	token := path[0]
+
+	switch current := node.(type) {
+	case map[string]any:
+		child, ok := current[token]
+		if !ok {
+			return nil, nil, ErrPathNotFound
+		}
+		if len(path) == 1 {
+			delete(current, token)
+			return current, child, nil
+		}
+		child, removed, err := remove(child, path[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		current[token] = child
+		return current, removed, nil
+	case []any:
+		index, err := arrayIndex(token, len(current), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(path) == 1 {
+			removed := current[index]
+			return append(current[:index], current[index+1:]...), removed, nil
+		}
+		child, removed, err := remove(current[index], path[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		current[index] = child
+		return current, removed, nil
+	default:
+		return nil, nil, ErrPathNotFound
+	}
+}
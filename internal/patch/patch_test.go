@@ -0,0 +1,63 @@
+package patch
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	doc := []byte(`{"title":"Casablanca","year":1942,"genres":["drama","romance"]}`)
+	got, err := Merge(doc, []byte(`{"year":1943,"genres":["drama"],"title":null}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"genres":["drama"],"year":1943}`
+	if string(got) != want {
+		t.Errorf("Merge() = %s, want %s", got, want)
+	}
+}
+
+func TestApply(t *testing.T) {
+	doc := []byte(`{"title":"Casablanca","genres":["drama","romance"],"version":2}`)
+	tests := []struct {
+		name string
+		ops  string
+		want string
+		err  error
+	}{
+		{"add to end", `[{"op":"add","path":"/genres/-","value":"war"}]`, `{"genres":["drama","romance","war"],"title":"Casablanca","version":2}`, nil},
+		{"insert", `[{"op":"add","path":"/genres/0","value":"war"}]`, `{"genres":["war","drama","romance"],"title":"Casablanca","version":2}`, nil},
+		{"remove", `[{"op":"remove","path":"/genres/1"}]`, `{"genres":["drama"],"title":"Casablanca","version":2}`, nil},
+		{"replace", `[{"op":"test","path":"/version","value":2},{"op":"replace","path":"/title","value":"Vertigo"}]`, `{"genres":["drama","romance"],"title":"Vertigo","version":2}`, nil},
+		{"move", `[{"op":"move","from":"/genres/0","path":"/genres/-"}]`, `{"genres":["romance","drama"],"title":"Casablanca","version":2}`, nil},
+		{"copy", `[{"op":"copy","from":"/title","path":"/original"}]`, `{"genres":["drama","romance"],"original":"Casablanca","title":"Casablanca","version":2}`, nil},
+		{"failed test", `[{"op":"test","path":"/version","value":1}]`, ``, ErrTestFailed},
+		{"missing path", `[{"op":"replace","path":"/runtime","value":1}]`, ``, ErrPathNotFound},
+		{"out of bounds", `[{"op":"add","path":"/genres/3","value":"war"}]`, ``, ErrPathNotFound},
+		{"missing value", `[{"op":"add","path":"/year"}]`, ``, ErrMissingValue},
+		{"unknown op", `[{"op":"increment","path":"/version"}]`, ``, ErrUnknownOp},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops, err := DecodeOperations([]byte(tt.ops))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Apply(doc, ops)
+			if tt.err != nil {
+				var opErr *OperationError
+				if !errors.As(err, &opErr) || !errors.Is(err, tt.err) {
+					t.Fatalf("Apply() error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Apply() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
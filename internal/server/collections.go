@@ -0,0 +1,315 @@
+package server
+
+import (
+	"errors"
+	"gin-project/internal/data"
+	"gin-project/internal/validator"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"net/http"
+)
+
+func (s *Server) listCollectionsHandler(c *gin.Context) {
+	var input struct {
+		Mine bool `form:"mine"`
+		data.Filters
+	}
+	input.Filters = data.NewFilters()
+	input.Sort = "-updated_at"
+	input.SortSafelist = []string{"name", "created_at", "updated_at", "-name", "-created_at", "-updated_at"}
+	err := c.ShouldBindQuery(&input)
+	if err != nil {
+		s.errorResponse(c, errInvalidQuery(err))
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		s.errorResponse(c, errFailedValidation(v.Errors))
+		return
+	}
+
+	user := s.contextGetUser(c)
+	collections, metadata, err := s.models.Collections.ListVisible(c.Request.Context(), user.ID, input.Mine, input.Filters)
+	if err != nil {
+		s.errorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"collections": collections, "metadata": metadata})
+}
+
+func (s *Server) createCollectionHandler(c *gin.Context) {
+	var input struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Public      bool   `json:"public"`
+	}
+	err := c.ShouldBindJSON(&input)
+	if err != nil {
+		s.errorResponse(c, errInvalidBody(err))
+		return
+	}
+
+	collection := &data.Collection{
+		UserID:      s.contextGetUser(c).ID,
+		Name:        input.Name,
+		Description: input.Description,
+		Public:      input.Public,
+	}
+
+	v := validator.New()
+	if data.ValidateCollection(v, collection); !v.Valid() {
+		s.errorResponse(c, errFailedValidation(v.Errors))
+		return
+	}
+
+	err = s.models.Collections.Insert(c.Request.Context(), collection)
+	if err != nil {
+		s.errorResponse(c, err)
+		return
+	}
+
+	c.Header("ETag", versionETag(collection.Version))
+	c.JSON(http.StatusCreated, gin.H{"collection": collection})
+}
+
+// getCollection load the collection named in the path, private collections of
+// other users are reported as not found so that their existence is not leaked.
+// When owned is set the collection must also belong to the user. It writes the
+// error response and returns nil when the collection cannot be used
+func (s *Server) getCollection(c *gin.Context, owned bool) *data.Collection {
+	id, ok := s.readUUIDParam(c, "id")
+	if !ok {
+		return nil
+	}
+
+	collection, err := s.models.Collections.Get(c.Request.Context(), id)
+	if err != nil {
+		s.errorResponse(c, err)
+		return nil
+	}
+
+	user := s.contextGetUser(c)
+	if collection.UserID != user.ID {
+		if !collection.Public {
+			s.errorResponse(c, errNotFound())
+			return nil
+		}
+		if owned {
+			s.errorResponse(c, errNotPermitted())
+			return nil
+		}
+	}
+	return collection
+}
+
+// getWatchlist load the watchlist of the user, it writes the error response
+// and returns nil when the watchlist cannot be loaded
+func (s *Server) getWatchlist(c *gin.Context) *data.Collection {
+	collection, err := s.models.Collections.GetWatchlist(c.Request.Context(), s.contextGetUser(c).ID)
+	if err != nil {
+		s.errorResponse(c, err)
+		return nil
+	}
+	return collection
+}
+
+// writeCollection send the collection along with its items
+func (s *Server) writeCollection(c *gin.Context, status int, collection *data.Collection) {
+	items, err := s.models.Collections.GetItems(c.Request.Context(), collection.ID)
+	if err != nil {
+		s.errorResponse(c, err)
+		return
+	}
+
+	c.Header("ETag", versionETag(collection.Version))
+	c.JSON(status, gin.H{"collection": collection, "items": items})
+}
+
+func (s *Server) showCollectionHandler(c *gin.Context) {
+	collection := s.getCollection(c, false)
+	if collection == nil {
+		return
+	}
+	s.writeCollection(c, http.StatusOK, collection)
+}
+
+func (s *Server) updateCollectionHandler(c *gin.Context) {
+	var input struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Public      bool   `json:"public"`
+		Version     *int32 `json:"version"`
+	}
+	err := c.ShouldBindJSON(&input)
+	if err != nil {
+		s.errorResponse(c, errInvalidBody(err))
+		return
+	}
+
+	collection := s.getCollection(c, true)
+	if collection == nil {
+		return
+	}
+
+	if !s.checkVersion(c, collection.Version, input.Version) {
+		return
+	}
+
+	collection.Name = input.Name
+	collection.Description = input.Description
+	collection.Public = input.Public
+
+	v := validator.New()
+	if data.ValidateCollection(v, collection); !v.Valid() {
+		s.errorResponse(c, errFailedValidation(v.Errors))
+		return
+	}
+
+	err = s.models.Collections.Update(c.Request.Context(), collection)
+	if err != nil {
+		s.errorResponse(c, err)
+		return
+	}
+
+	c.Header("ETag", versionETag(collection.Version))
+	c.JSON(http.StatusOK, gin.H{"collection": collection})
+}
+
+func (s *Server) deleteCollectionHandler(c *gin.Context) {
+	collection := s.getCollection(c, true)
+	if collection == nil {
+		return
+	}
+
+	// the watchlist is emptied through its items, it always exists
+	if collection.Watchlist {
+		s.errorResponse(c, errConflict("watchlist_not_deletable", "the watchlist cannot be deleted"))
+		return
+	}
+
+	err := s.models.Collections.Delete(c.Request.Context(), collection.ID)
+	if err != nil {
+		s.errorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "collection deleted"})
+}
+
+// readMovieIDs decode and validate the movie_ids of a bulk request body
+func (s *Server) readMovieIDs(c *gin.Context) ([]uuid.UUID, bool) {
+	var input struct {
+		MovieIDs []uuid.UUID `json:"movie_ids"`
+	}
+	err := c.ShouldBindJSON(&input)
+	if err != nil {
+		s.errorResponse(c, errInvalidBody(err))
+		return nil, false
+	}
+
+	v := validator.New()
+	if data.ValidateCollectionMovies(v, input.MovieIDs); !v.Valid() {
+		s.errorResponse(c, errFailedValidation(v.Errors))
+		return nil, false
+	}
+	return input.MovieIDs, true
+}
+
+func (s *Server) addCollectionItems(c *gin.Context, collection *data.Collection) {
+	movieIDs, ok := s.readMovieIDs(c)
+	if !ok {
+		return
+	}
+
+	err := s.models.Collections.AddItems(c.Request.Context(), collection, movieIDs)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrUnknownMovies):
+			s.errorResponse(c, errFailedValidation(map[string]string{"movie_ids": "must only contain existing movies"}))
+		default:
+			s.errorResponse(c, err)
+		}
+		return
+	}
+
+	s.writeCollection(c, http.StatusOK, collection)
+}
+
+func (s *Server) removeCollectionItems(c *gin.Context, collection *data.Collection) {
+	movieIDs, ok := s.readMovieIDs(c)
+	if !ok {
+		return
+	}
+
+	err := s.models.Collections.RemoveItems(c.Request.Context(), collection, movieIDs)
+	if err != nil {
+		s.errorResponse(c, err)
+		return
+	}
+
+	s.writeCollection(c, http.StatusOK, collection)
+}
+
+func (s *Server) reorderCollectionItems(c *gin.Context, collection *data.Collection) {
+	movieIDs, ok := s.readMovieIDs(c)
+	if !ok {
+		return
+	}
+
+	err := s.models.Collections.Reorder(c.Request.Context(), collection, movieIDs)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidOrder):
+			s.errorResponse(c, errFailedValidation(map[string]string{"movie_ids": "must list every movie of the collection exactly once"}))
+		default:
+			s.errorResponse(c, err)
+		}
+		return
+	}
+
+	s.writeCollection(c, http.StatusOK, collection)
+}
+
+func (s *Server) addCollectionItemsHandler(c *gin.Context) {
+	if collection := s.getCollection(c, true); collection != nil {
+		s.addCollectionItems(c, collection)
+	}
+}
+
+func (s *Server) removeCollectionItemsHandler(c *gin.Context) {
+	if collection := s.getCollection(c, true); collection != nil {
+		s.removeCollectionItems(c, collection)
+	}
+}
+
+func (s *Server) reorderCollectionItemsHandler(c *gin.Context) {
+	if collection := s.getCollection(c, true); collection != nil {
+		s.reorderCollectionItems(c, collection)
+	}
+}
+
+func (s *Server) showWatchlistHandler(c *gin.Context) {
+	if collection := s.getWatchlist(c); collection != nil {
+		s.writeCollection(c, http.StatusOK, collection)
+	}
+}
+
+func (s *Server) addWatchlistItemsHandler(c *gin.Context) {
+	if collection := s.getWatchlist(c); collection != nil {
+		s.addCollectionItems(c, collection)
+	}
+}
+
+func (s *Server) removeWatchlistItemsHandler(c *gin.Context) {
+	if collection := s.getWatchlist(c); collection != nil {
+		s.removeCollectionItems(c, collection)
+	}
+}
+
+func (s *Server) reorderWatchlistItemsHandler(c *gin.Context) {
+	if collection := s.getWatchlist(c); collection != nil {
+		s.reorderCollectionItems(c, collection)
+	}
+}
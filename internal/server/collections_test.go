@@ -0,0 +1,85 @@
+package server
+
+import (
+	"database/sql/driver"
+	"errors"
+	"gin-project/internal/data"
+	"gin-project/internal/database"
+	logger "gin-project/internal/log"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollectionItemsChangeETag(t *testing.T) {
+	collectionID := uuid.New()
+	userID := uuid.New()
+	movieID := uuid.New()
+	created := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	version := int64(1)
+	db := newFakeDB(func(query string, args []driver.NamedValue) ([]string, [][]driver.Value, error) {
+		switch {
+		case strings.Contains(query, "UPDATE collections"):
+			version++
+			return []string{"updated_at", "version", "count"}, [][]driver.Value{{created, version, int64(1)}}, nil
+		case strings.Contains(query, "FOR UPDATE"):
+			return []string{"id"}, [][]driver.Value{{collectionID.String()}}, nil
+		case strings.Contains(query, "FROM collections"):
+			return []string{"id", "created_at", "updated_at", "user_id", "name", "description", "public", "watchlist", "count", "version"},
+				[][]driver.Value{{collectionID.String(), created, created, userID.String(), "Favourites", "", false, false, int64(1), version}}, nil
+		case strings.Contains(query, "FROM movies"):
+			return []string{"count"}, [][]driver.Value{{int64(1)}}, nil
+		case strings.Contains(query, "SELECT collection_items.movie_id"):
+			return []string{"movie_id"}, [][]driver.Value{{movieID.String()}}, nil
+		case strings.Contains(query, "FROM collection_items"):
+			return []string{"position", "added_at", "id", "created_at", "title", "year", "runtime", "genres", "version"},
+				[][]driver.Value{{int64(1), created, movieID.String(), created, "Casablanca", int64(1942), int64(102), []byte("{drama}"), int64(1)}}, nil
+		case strings.Contains(query, "collection_items"):
+			return nil, nil, nil
+		}
+		return nil, nil, errors.New("unexpected query " + query)
+	})
+
+	var svc database.Service = db
+	s := &Server{models: data.NewModels(&svc), logger: logger.New(io.Discard, logger.LevelInfo)}
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		s.contextSetUser(c, &data.User{ID: userID, Activated: true})
+	})
+	r.GET("/v1/collections/:id", s.showCollectionHandler)
+	r.POST("/v1/collections/:id/items", s.addCollectionItemsHandler)
+	r.DELETE("/v1/collections/:id/items", s.removeCollectionItemsHandler)
+	r.PUT("/v1/collections/:id/items/order", s.reorderCollectionItemsHandler)
+
+	path := "/v1/collections/" + collectionID.String()
+	body := `{"movie_ids": ["` + movieID.String() + `"]}`
+	requests := []struct{ method, path string }{
+		{http.MethodGet, path},
+		{http.MethodPost, path + "/items"},
+		{http.MethodPut, path + "/items/order"},
+		{http.MethodDelete, path + "/items"},
+	}
+
+	seen := make(map[string]bool)
+	for _, request := range requests {
+		req := httptest.NewRequest(request.method, request.path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s %s: status = %d: %s", request.method, request.path, rr.Code, rr.Body.String())
+		}
+		etag := rr.Header().Get("ETag")
+		if etag == "" || seen[etag] {
+			t.Errorf("%s %s: the ETag %q did not change with the items", request.method, request.path, etag)
+		}
+		seen[etag] = true
+	}
+}
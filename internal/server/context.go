@@ -0,0 +1,43 @@
+package server
+
+import (
+	"gin-project/internal/data"
+	logger "gin-project/internal/log"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	userContextKey      = "user"
+	requestIDContextKey = "request_id"
+	loggerContextKey    = "logger"
+)
+
+// contextSetUser store the user in the gin context
+func (s *Server) contextSetUser(c *gin.Context, user *data.User) {
+	c.Set(userContextKey, user)
+}
+
+// contextGetUser retrieve the user from the gin context, it should only be called
+// after the authenticate middleware has run
+func (s *Server) contextGetUser(c *gin.Context) *data.User {
+	user, ok := c.MustGet(userContextKey).(*data.User)
+	if !ok {
+		panic("missing user value in request context")
+	}
+	return user
+}
+
+// requestID return the identifier assigned to the request by the requestLogger
+// middleware, empty when it did not run
+func (s *Server) requestID(c *gin.Context) string {
+	return c.GetString(requestIDContextKey)
+}
+
+// contextGetLogger return the request logger, which tags every entry with the
+// request ID, or the server logger when the requestLogger middleware did not run
+func (s *Server) contextGetLogger(c *gin.Context) *logger.Logger {
+	if l, ok := c.Get(loggerContextKey); ok {
+		return l.(*logger.Logger)
+	}
+	return s.logger
+}
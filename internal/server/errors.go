@@ -1,24 +1,247 @@
 package server
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gin-project/internal/data"
 	"github.com/gin-gonic/gin"
+	"io"
 	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
 )
 
-func (s *Server) errorResponse(c *gin.Context, status int, message interface{}) {
-	c.JSON(status, gin.H{"error": message})
-	c.AbortWithStatus(status)
+// Problem is an RFC 7807 problem details document. Handlers pick one from the
+// catalogue below and pass it to errorResponse rather than writing ad hoc
+// error bodies, Code is the stable identifier clients should match on.
+type Problem struct {
+	Type      string            `json:"type"`
+	Title     string            `json:"title"`
+	Status    int               `json:"status"`
+	Detail    string            `json:"detail,omitempty"`
+	Instance  string            `json:"instance,omitempty"`
+	Code      string            `json:"code"`
+	Errors    map[string]string `json:"errors,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+	// cause is logged for server errors, it is never sent to the client
+	cause error
 }
 
-func (s *Server) serverErrorResponse(c *gin.Context, err error) {
-	s.errorLog.PrintError(err, nil)
-	message := "the server encountered a problem and could not process your request"
-	s.errorResponse(c, http.StatusInternalServerError, message)
+func (p *Problem) Error() string {
+	if p.Detail == "" {
+		return p.Code
+	}
+	return p.Code + ": " + p.Detail
 }
-func (s *Server) notFoundResponse(c *gin.Context) {
-	s.errorResponse(c, http.StatusNotFound, "resource not found")
+
+func (p *Problem) Unwrap() error {
+	return p.cause
+}
+
+func newProblem(status int, code, detail string) *Problem {
+	return &Problem{
+		Type:   "/problems/" + code,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+func errServer(err error) *Problem {
+	p := newProblem(http.StatusInternalServerError, "internal_error", "the server encountered a problem and could not process your request")
+	p.cause = err
+	return p
+}
+
+func errNotFound() *Problem {
+	return newProblem(http.StatusNotFound, "not_found", "the requested resource could not be found")
+}
+
+func errMethodNotAllowed(method string) *Problem {
+	return newProblem(http.StatusMethodNotAllowed, "method_not_allowed", "the "+method+" method is not supported for this resource")
+}
+
+// errBadRequest report a request that cannot be read, such as malformed JSON
+// or query parameters of the wrong type
+func errBadRequest(detail string) *Problem {
+	return newProblem(http.StatusBadRequest, "bad_request", detail)
+}
+
+// errInvalidBody translate the error of reading or decoding a request body, the
+// messages of the decoder are not part of the API. Values of the wrong type and
+// unknown fields are reported by field, a body past its size limit is a
+// payload too large.
+func errInvalidBody(err error) *Problem {
+	var p *Problem
+	var maxBytesError *http.MaxBytesError
+	var syntaxError *json.SyntaxError
+	var typeError *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &p):
+		return p
+	case errors.As(err, &maxBytesError):
+		return errPayloadTooLarge(fmt.Sprintf("the body must not be larger than %d bytes", maxBytesError.Limit))
+	case errors.Is(err, io.EOF):
+		return errBadRequest("the body must not be empty")
+	case errors.As(err, &syntaxError), errors.Is(err, io.ErrUnexpectedEOF):
+		return errBadRequest("the body contains badly-formed JSON")
+	case errors.As(err, &typeError) && typeError.Field != "":
+		p = errBadRequest("the body contains a value of the wrong type")
+		p.Errors = map[string]string{typeError.Field: "must be " + jsonKind(typeError.Type)}
+		return p
+	case errors.As(err, &typeError):
+		return errBadRequest("the body must be " + jsonKind(typeError.Type))
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no error type for the unknown fields
+		field, _ := strconv.Unquote(strings.TrimPrefix(err.Error(), "json: unknown field "))
+		p = errBadRequest("the body contains an unknown field")
+		p.Errors = map[string]string{field: "is not a known field"}
+		return p
+	case errors.Is(err, data.ErrInvalidRuntimeFormat):
+		// the runtime member is the only one decoded by data.Runtime
+		p = errBadRequest("the body contains an invalid runtime")
+		p.Errors = map[string]string{"runtime": "invalid runtime format"}
+		return p
+	}
+	return errBadRequest("the body could not be read")
+}
+
+// errInvalidQuery translate the error of binding the query string, gin does
+// not name the parameter which failed so only the kind of value is reported
+func errInvalidQuery(err error) *Problem {
+	var numError *strconv.NumError
+	switch {
+	case errors.Is(err, data.ErrInvalidRuntimeFormat):
+		return errBadRequest("the query string contains an invalid runtime")
+	case errors.As(err, &numError):
+		return errBadRequest("the query string contains an invalid number")
+	}
+	return errBadRequest("the query string contains an invalid parameter")
+}
+
+// jsonKind describe the JSON value expected for a Go type
+func jsonKind(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	}
+	return "an object"
+}
+
+func errFailedValidation(errors map[string]string) *Problem {
+	p := newProblem(http.StatusUnprocessableEntity, "validation_failed", "the request contains invalid fields")
+	p.Errors = errors
+	return p
+}
+
+// errImportAborted report the row which stopped an import, its errors are
+// keyed by line and field
+func errImportAborted(row importRowError) *Problem {
+	errors := make(map[string]string, len(row.Errors))
+	for field, message := range row.Errors {
+		errors[fmt.Sprintf("lines[%d].%s", row.Line, field)] = message
+	}
+	p := errFailedValidation(errors)
+	p.Detail = fmt.Sprintf("the import was aborted at line %d, no movie was inserted", row.Line)
+	return p
+}
+
+func errEditConflict() *Problem {
+	return newProblem(http.StatusConflict, "edit_conflict", "unable to update the record due to an edit conflict, please try again")
+}
+
+// errDuplicate report a record clashing with an existing one, errors name the
+// clashing fields
+func errDuplicate(errors map[string]string) *Problem {
+	p := newProblem(http.StatusConflict, "duplicate_record", "the record already exists")
+	p.Errors = errors
+	return p
+}
+
+// errConflict report a request conflicting with the state of a resource
+func errConflict(code, detail string) *Problem {
+	return newProblem(http.StatusConflict, code, detail)
+}
+
+func errPreconditionRequired() *Problem {
+	return newProblem(http.StatusPreconditionRequired, "precondition_required", "the current version must be provided in the request body or the If-Match header")
+}
+
+func errUnsupportedMediaType(detail string) *Problem {
+	return newProblem(http.StatusUnsupportedMediaType, "unsupported_media_type", detail)
+}
+
+func errPayloadTooLarge(detail string) *Problem {
+	return newProblem(http.StatusRequestEntityTooLarge, "payload_too_large", detail)
+}
+
+func errRateLimitExceeded() *Problem {
+	return newProblem(http.StatusTooManyRequests, "rate_limit_exceeded", "rate limit exceeded")
+}
+
+func errInvalidCredentials() *Problem {
+	return newProblem(http.StatusUnauthorized, "invalid_credentials", "invalid authentication credentials")
+}
+
+func errInvalidAuthenticationToken() *Problem {
+	return newProblem(http.StatusUnauthorized, "invalid_token", "invalid or missing authentication token")
+}
+
+func errAuthenticationRequired() *Problem {
+	return newProblem(http.StatusUnauthorized, "authentication_required", "you must be authenticated to access this resource")
+}
+
+func errInactiveAccount() *Problem {
+	return newProblem(http.StatusForbidden, "inactive_account", "your user account must be activated to access this resource")
+}
+
+func errNotPermitted() *Problem {
+	return newProblem(http.StatusForbidden, "not_permitted", "your user account doesn't have the necessary permissions to access this resource")
 }
 
-func (s *Server) rateLimitExceededResponse(c *gin.Context) {
-	s.errorResponse(c, http.StatusTooManyRequests, "rate limit exceeded")
+// errorResponse write err as an application/problem+json response and abort
+// the request. The sentinel errors of the data package are mapped to their
+// problem, any other error is logged and reported as a server error.
+func (s *Server) errorResponse(c *gin.Context, err error) {
+	var p *Problem
+	switch {
+	case errors.As(err, &p):
+	case errors.Is(err, data.ErrRecordNotFound):
+		p = errNotFound()
+	case errors.Is(err, data.ErrEditConflict):
+		p = errEditConflict()
+	default:
+		p = errServer(err)
+	}
+
+	if p.cause != nil {
+		s.contextGetLogger(c).Error(p.cause,
+			"request_method", c.Request.Method,
+			"request_url", c.Request.URL.String(),
+		)
+	}
+
+	problem := *p
+	problem.Instance = c.Request.URL.Path
+	problem.RequestID = s.requestID(c)
+
+	if problem.Status == http.StatusUnauthorized {
+		c.Header("WWW-Authenticate", "Bearer")
+	}
+	c.Header("Content-Type", "application/problem+json")
+	c.AbortWithStatusJSON(problem.Status, problem)
 }
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"gin-project/internal/data"
+	logger "gin-project/internal/log"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestErrorResponse(t *testing.T) {
+	s := &Server{logger: logger.New(io.Discard, logger.LevelInfo)}
+
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{errFailedValidation(map[string]string{"title": "must be provided"}), http.StatusUnprocessableEntity, "validation_failed"},
+		{data.ErrRecordNotFound, http.StatusNotFound, "not_found"},
+		{data.ErrEditConflict, http.StatusConflict, "edit_conflict"},
+		{errors.New("pq: connection refused"), http.StatusInternalServerError, "internal_error"},
+	}
+
+	for _, tt := range tests {
+		r := gin.New()
+		r.Use(s.requestLogger())
+		r.GET("/v1/movies", func(c *gin.Context) {
+			s.errorResponse(c, tt.err)
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/v1/movies?page=2", nil)
+		req.Header.Set("X-Request-ID", "abc")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+
+		if rr.Code != tt.status {
+			t.Errorf("%v: got status %d, want %d", tt.err, rr.Code, tt.status)
+		}
+		if ct := rr.Header().Get("Content-Type"); ct != "application/problem+json" {
+			t.Errorf("%v: got content type %q", tt.err, ct)
+		}
+
+		var problem Problem
+		if err := json.Unmarshal(rr.Body.Bytes(), &problem); err != nil {
+			t.Fatalf("%v: invalid body %q", tt.err, rr.Body.String())
+		}
+		if problem.Code != tt.code || problem.Status != tt.status || problem.Instance != "/v1/movies" || problem.RequestID != "abc" {
+			t.Errorf("%v: unexpected problem %+v", tt.err, problem)
+		}
+		if strings.Contains(rr.Body.String(), "connection refused") {
+			t.Errorf("%v: the cause of a server error must not be exposed", tt.err)
+		}
+	}
+}
+
+func TestErrInvalidBody(t *testing.T) {
+	type input struct {
+		Title   string       `json:"title"`
+		Year    int32        `json:"year"`
+		Runtime data.Runtime `json:"runtime"`
+	}
+
+	tests := []struct {
+		body   string
+		status int
+		field  string
+	}{
+		{``, http.StatusBadRequest, ""},
+		{`{"title": `, http.StatusBadRequest, ""},
+		{`{"title": "Moana",}`, http.StatusBadRequest, ""},
+		{`["Moana"]`, http.StatusBadRequest, ""},
+		{`{"year": "2016"}`, http.StatusBadRequest, "year"},
+		{`{"runtime": "soon"}`, http.StatusBadRequest, "runtime"},
+		{`{"rating": 5}`, http.StatusBadRequest, "rating"},
+		{`{"title": "` + strings.Repeat("a", 64) + `"}`, http.StatusRequestEntityTooLarge, ""},
+	}
+
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		body := http.MaxBytesReader(rr, io.NopCloser(strings.NewReader(tt.body)), 32)
+		dec := json.NewDecoder(body)
+		dec.DisallowUnknownFields()
+		var v input
+		err := dec.Decode(&v)
+		if err == nil {
+			t.Fatalf("%q: expected a decode error", tt.body)
+		}
+
+		p := errInvalidBody(err)
+		if p.Status != tt.status {
+			t.Errorf("%q: status = %d, want %d", tt.body, p.Status, tt.status)
+		}
+		if tt.field != "" && p.Errors[tt.field] == "" {
+			t.Errorf("%q: expected a %s error, got %v", tt.body, tt.field, p.Errors)
+		}
+		// the decoder messages are not part of the API
+		if strings.Contains(p.Error(), "json:") || strings.Contains(p.Error(), "invalid character") {
+			t.Errorf("%q: the decoder error leaks into %q", tt.body, p.Error())
+		}
+	}
+}
+
+func TestImportBodyTooLarge(t *testing.T) {
+	s := &Server{logger: logger.New(io.Discard, logger.LevelInfo)}
+	r := gin.New()
+	r.POST("/v1/movies/import", s.importMoviesHandler)
+
+	// blank lines are skipped, only the size of the body is over the limit
+	req := httptest.NewRequest(http.MethodPost, "/v1/movies/import", strings.NewReader(strings.Repeat("\n", importMaxBytes+1)))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want %d: %s", rr.Code, http.StatusRequestEntityTooLarge, rr.Body.String())
+	}
+}
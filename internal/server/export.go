@@ -0,0 +1,216 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gin-project/internal/data"
+	"gin-project/internal/validator"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportFlushEvery is the number of movies written between two flushes of the response
+const exportFlushEvery = 500
+
+// exportStatusTrailer is the HTTP trailer ending every export, it is set to
+// complete once the whole document is written and to incomplete when the
+// export fails midway. A CSV or NDJSON export cut off between two rows looks
+// complete, the trailer is the only way for the client to tell.
+const exportStatusTrailer = "Export-Status"
+
+// movieEncoder write the movies of an export one at a time, Close terminates the document
+type movieEncoder interface {
+	Encode(movie *data.Movie) error
+	Close() error
+}
+
+var exportFormats = map[string]struct {
+	contentType string
+	newEncoder  func(w io.Writer) movieEncoder
+}{
+	"csv":    {"text/csv; charset=utf-8", newCSVMovieEncoder},
+	"ndjson": {"application/x-ndjson", newNDJSONMovieEncoder},
+	"json":   {"application/json; charset=utf-8", newJSONMovieEncoder},
+}
+
+// csvMovieEncoder write a header row then one row per movie, genres are
+// joined with "|"
+type csvMovieEncoder struct {
+	writer *csv.Writer
+}
+
+func newCSVMovieEncoder(w io.Writer) movieEncoder {
+	writer := csv.NewWriter(w)
+	// write errors are kept by the writer and reported by Error
+	writer.Write([]string{"id", "title", "year", "runtime", "genres", "version", "average_rating", "rating_count"})
+	return &csvMovieEncoder{writer: writer}
+}
+
+func (e *csvMovieEncoder) Encode(movie *data.Movie) error {
+	return e.writer.Write([]string{
+		movie.ID.String(),
+		movie.Title,
+		strconv.Itoa(int(movie.Year)),
+		movie.Runtime.String(),
+		strings.Join(movie.Genres, "|"),
+		strconv.Itoa(int(movie.Version)),
+		strconv.FormatFloat(movie.AverageRating, 'f', -1, 64),
+		strconv.Itoa(movie.RatingCount),
+	})
+}
+
+func (e *csvMovieEncoder) Close() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+// ndjsonMovieEncoder write one JSON movie per line
+type ndjsonMovieEncoder struct {
+	encoder *json.Encoder
+}
+
+func newNDJSONMovieEncoder(w io.Writer) movieEncoder {
+	return &ndjsonMovieEncoder{encoder: json.NewEncoder(w)}
+}
+
+func (e *ndjsonMovieEncoder) Encode(movie *data.Movie) error {
+	return e.encoder.Encode(movie)
+}
+
+func (e *ndjsonMovieEncoder) Close() error {
+	return nil
+}
+
+// jsonMovieEncoder write a {"movies": [...]} document one element at a time
+type jsonMovieEncoder struct {
+	w     io.Writer
+	count int
+}
+
+func newJSONMovieEncoder(w io.Writer) movieEncoder {
+	return &jsonMovieEncoder{w: w}
+}
+
+func (e *jsonMovieEncoder) Encode(movie *data.Movie) error {
+	js, err := json.Marshal(movie)
+	if err != nil {
+		return err
+	}
+	separator := ","
+	if e.count == 0 {
+		separator = `{"movies":[`
+	}
+	e.count++
+	_, err = io.WriteString(e.w, separator+string(js))
+	return err
+}
+
+func (e *jsonMovieEncoder) Close() error {
+	if e.count == 0 {
+		_, err := io.WriteString(e.w, `{"movies":[]}`+"\n")
+		return err
+	}
+	_, err := io.WriteString(e.w, "]}\n")
+	return err
+}
+
+func (s *Server) exportMoviesHandler(c *gin.Context) {
+	var input struct {
+		data.MovieFilters
+		data.Filters
+		Format string `form:"format"`
+	}
+	input.MovieFilters = data.NewMovieFilters()
+	input.Filters = data.NewFilters()
+	input.Filters.Sort = "id"
+	input.Filters.SortSafelist = []string{"id", "title", "year", "runtime", "relevance", "average_rating", "rating_count",
+		"-id", "-title", "-year", "-runtime", "-average_rating", "-rating_count"}
+	input.Format = "json"
+	err := c.ShouldBindQuery(&input)
+	if err != nil {
+		s.errorResponse(c, errInvalidQuery(err))
+		return
+	}
+	if len(input.Genres) > 0 {
+		input.Genres = strings.Split(input.Genres[0], ",")
+	}
+	if len(input.ExcludeGenres) > 0 {
+		input.ExcludeGenres = strings.Split(input.ExcludeGenres[0], ",")
+	}
+
+	v := validator.New()
+	data.ValidateMovieFilters(v, input.MovieFilters)
+	v.Check(validator.In(input.Format, "csv", "ndjson", "json"), "format", "must be one of csv, ndjson or json")
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		s.errorResponse(c, errFailedValidation(v.Errors))
+		return
+	}
+
+	// a full dump outlives the write timeout of the server, it is bounded by
+	// the export timeout instead
+	err = extendWriteDeadline(c, data.ExportTimeout)
+	if err != nil {
+		s.errorResponse(c, err)
+		return
+	}
+
+	format := exportFormats[input.Format]
+	filename := fmt.Sprintf("movies-%s.%s", time.Now().UTC().Format("20060102"), input.Format)
+	c.Header("Content-Type", format.contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Header("Trailer", exportStatusTrailer)
+	c.Status(http.StatusOK)
+
+	encoder := format.newEncoder(c.Writer)
+	count := 0
+	err = s.models.Movies.Export(c.Request.Context(), input.MovieFilters, input.Filters, func(movie *data.Movie) error {
+		err := encoder.Encode(movie)
+		if err != nil {
+			return err
+		}
+		if count++; count%exportFlushEvery == 0 {
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		// nothing was streamed yet, a regular error response can still be sent
+		if !c.Writer.Written() {
+			c.Writer.Header().Del("Content-Type")
+			c.Writer.Header().Del("Content-Disposition")
+			c.Writer.Header().Del("Trailer")
+			s.errorResponse(c, err)
+			return
+		}
+		// the status line is already sent, the failure is reported through the
+		// trailer and the document is left unterminated
+		c.Writer.Header().Set(exportStatusTrailer, "incomplete")
+		s.contextGetLogger(c).Error(err, "request_url", c.Request.URL.String())
+		return
+	}
+
+	err = encoder.Close()
+	if err != nil {
+		c.Writer.Header().Set(exportStatusTrailer, "incomplete")
+		s.contextGetLogger(c).Error(err, "request_url", c.Request.URL.String())
+		return
+	}
+	c.Writer.Header().Set(exportStatusTrailer, "complete")
+}
+
+// extendWriteDeadline let the response be written for d from now, whatever the
+// write timeout of the server. Writers without deadlines, such as the test
+// recorders, are left alone.
+func extendWriteDeadline(c *gin.Context, d time.Duration) error {
+	err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Now().Add(d))
+	if errors.Is(err, http.ErrNotSupported) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"gin-project/internal/data"
+	"gin-project/internal/database"
+	logger "gin-project/internal/log"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMovieEncoders(t *testing.T) {
+	movies := []*data.Movie{
+		{Title: "Casablanca", Year: 1942, Runtime: 102, Genres: []string{"drama", "romance"}},
+		{Title: "Moana", Year: 2016, Runtime: 107, Genres: []string{"animation"}},
+	}
+
+	for format, want := range map[string]string{"csv": "102 mins", "ndjson": `"runtime":"102 mins"`, "json": `"runtime":"102 mins"`} {
+		for _, count := range []int{0, len(movies)} {
+			var buf bytes.Buffer
+			encoder := exportFormats[format].newEncoder(&buf)
+			for _, movie := range movies[:count] {
+				if err := encoder.Encode(movie); err != nil {
+					t.Fatalf("%s: Encode: %v", format, err)
+				}
+			}
+			if err := encoder.Close(); err != nil {
+				t.Fatalf("%s: Close: %v", format, err)
+			}
+
+			if count > 0 && !strings.Contains(buf.String(), want) {
+				t.Errorf("%s: runtime not rendered as %q in %q", format, want, buf.String())
+			}
+			if format == "json" {
+				var document struct {
+					Movies []json.RawMessage `json:"movies"`
+				}
+				if err := json.Unmarshal(buf.Bytes(), &document); err != nil || len(document.Movies) != count {
+					t.Errorf("json: got %d movies, err %v in %q", len(document.Movies), err, buf.String())
+				}
+			}
+		}
+	}
+}
+
+func TestExtendWriteDeadline(t *testing.T) {
+	r := gin.New()
+	r.GET("/export", func(c *gin.Context) {
+		if c.Query("extend") != "" {
+			if err := extendWriteDeadline(c, time.Second); err != nil {
+				t.Errorf("extendWriteDeadline: %v", err)
+			}
+		}
+		// outlive the write timeout of the server before streaming
+		time.Sleep(200 * time.Millisecond)
+		c.String(http.StatusOK, "complete")
+	})
+
+	srv := httptest.NewUnstartedServer(r)
+	srv.Config.WriteTimeout = 50 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/export?extend=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || string(body) != "complete" {
+		t.Errorf("extended export: got %q, %v", body, err)
+	}
+
+	// without the extension the server write timeout cuts the response off
+	resp, err = http.Get(srv.URL + "/export")
+	if err == nil {
+		body, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	if err == nil && string(body) == "complete" {
+		t.Error("expected the response to be cut off by the write timeout")
+	}
+
+	// the test recorders do not support deadlines, they are left alone
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	if err := extendWriteDeadline(c, time.Second); err != nil {
+		t.Errorf("extendWriteDeadline on a recorder: %v", err)
+	}
+}
+
+func TestExportStatusTrailer(t *testing.T) {
+	created := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	movie := func(year any) []driver.Value {
+		return []driver.Value{uuid.NewString(), created, "Casablanca", year, int64(102), []byte("{drama}"), int64(1), 0.0, int64(0)}
+	}
+
+	for _, tt := range []struct {
+		name   string
+		rows   [][]driver.Value
+		lines  int
+		status string
+	}{
+		{"complete", [][]driver.Value{movie(int64(1942)), movie(int64(1943))}, 2, "complete"},
+		// the second row cannot be scanned once the first one is streamed
+		{"incomplete", [][]driver.Value{movie(int64(1942)), movie("soon")}, 1, "incomplete"},
+	} {
+		db := newFakeDB(func(query string, args []driver.NamedValue) ([]string, [][]driver.Value, error) {
+			switch {
+			case strings.HasPrefix(query, "DECLARE"):
+				return nil, nil, nil
+			case strings.HasPrefix(query, "FETCH"):
+				return []string{"id", "created_at", "title", "year", "runtime", "genres", "version", "average_rating", "rating_count"}, tt.rows, nil
+			}
+			return nil, nil, errors.New("unexpected query " + query)
+		})
+
+		var svc database.Service = db
+		s := &Server{models: data.NewModels(&svc), logger: logger.New(io.Discard, logger.LevelInfo)}
+		r := gin.New()
+		r.GET("/v1/movies/export", s.exportMoviesHandler)
+		srv := httptest.NewServer(r)
+
+		resp, err := http.Get(srv.URL + "/v1/movies/export?format=ndjson")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		srv.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if n := strings.Count(string(body), "\n"); n != tt.lines {
+			t.Errorf("%s: got %d movies, want %d", tt.name, n, tt.lines)
+		}
+		if status := resp.Trailer.Get(exportStatusTrailer); status != tt.status {
+			t.Errorf("%s: %s trailer = %q, want %q", tt.name, exportStatusTrailer, status, tt.status)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"strconv"
+	"strings"
+)
+
+// background run fn in a goroutine tracked by the server wait group, so that
+// shutdown waits for it, and recover any panic it raises
+func (s *Server) background(fn func()) {
+	s.wg.Add(1)
+
+	go func() {
+		defer s.wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				s.logger.Error(fmt.Errorf("%s", err))
+			}
+		}()
+
+		fn()
+	}()
+}
+
+// versionETag format a record version as a strong ETag
+func versionETag(version int32) string {
+	return strconv.Quote(strconv.FormatInt(int64(version), 10))
+}
+
+// parseVersionETag read the record version back from an If-Match or If-None-Match header
+func parseVersionETag(header string) (int32, bool) {
+	header = strings.TrimPrefix(strings.TrimSpace(header), "W/")
+	unquoted, err := strconv.Unquote(header)
+	if err != nil {
+		return 0, false
+	}
+	version, err := strconv.ParseInt(unquoted, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return int32(version), true
+}
+
+// readUUIDParam parse the named path parameter as a UUID, it writes a 404
+// response and returns false when the parameter is not a valid UUID
+func (s *Server) readUUIDParam(c *gin.Context, name string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param(name))
+	if err != nil {
+		s.errorResponse(c, errNotFound())
+		return uuid.Nil, false
+	}
+	return id, true
+}
@@ -0,0 +1,279 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gin-project/internal/data"
+	"gin-project/internal/validator"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	importMaxBytes     = 32 << 20
+	importMaxRows      = 10_000
+	importMaxLineBytes = 1 << 20
+)
+
+// movieRowReader decode the movies of an import stream one row at a time. A
+// row that cannot be decoded is reported through rowErrors and the import
+// carries on with the next row, err is io.EOF at the end of the stream and
+// any other error means the stream itself cannot be read any further
+type movieRowReader interface {
+	Read() (movie *data.Movie, line int, rowErrors map[string]string, err error)
+}
+
+// csvMovieReader read a CSV stream with a header row naming the title, year,
+// runtime and genres columns, genres are separated by "|"
+type csvMovieReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+var csvMovieColumns = []string{"title", "year", "runtime", "genres"}
+
+func newCSVMovieReader(r io.Reader) (*csvMovieReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		switch {
+		case errors.Is(err, io.EOF):
+			return nil, errBadRequest("the CSV header row is missing")
+		case errors.As(err, &parseErr):
+			return nil, errBadRequest("the CSV header row is malformed")
+		}
+		return nil, err
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !validator.In(name, csvMovieColumns...) {
+			return nil, errBadRequest(fmt.Sprintf("unknown CSV column %q", name))
+		}
+		if _, exists := columns[name]; exists {
+			return nil, errBadRequest(fmt.Sprintf("duplicate CSV column %q", name))
+		}
+		columns[name] = i
+	}
+	for _, name := range csvMovieColumns {
+		if _, exists := columns[name]; !exists {
+			return nil, errBadRequest(fmt.Sprintf("missing CSV column %q", name))
+		}
+	}
+
+	return &csvMovieReader{reader: reader, columns: columns}, nil
+}
+
+func (r *csvMovieReader) Read() (*data.Movie, int, map[string]string, error) {
+	record, err := r.reader.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return nil, parseErr.StartLine, map[string]string{"row": parseErr.Err.Error()}, nil
+		}
+		return nil, 0, nil, err
+	}
+	line, _ := r.reader.FieldPos(0)
+
+	if len(record) != len(r.columns) {
+		return nil, line, map[string]string{"row": fmt.Sprintf("must have %d fields", len(r.columns))}, nil
+	}
+
+	rowErrors := make(map[string]string)
+	movie := &data.Movie{Title: record[r.columns["title"]]}
+
+	year, err := strconv.ParseInt(strings.TrimSpace(record[r.columns["year"]]), 10, 32)
+	if err != nil {
+		rowErrors["year"] = "must be an integer"
+	}
+	movie.Year = int32(year)
+
+	movie.Runtime, err = data.ParseRuntime(record[r.columns["runtime"]])
+	if err != nil {
+		rowErrors["runtime"] = "invalid runtime format"
+	}
+
+	movie.Genres = []string{}
+	for _, genre := range strings.Split(record[r.columns["genres"]], "|") {
+		if genre = strings.TrimSpace(genre); genre != "" {
+			movie.Genres = append(movie.Genres, genre)
+		}
+	}
+
+	if len(rowErrors) > 0 {
+		return nil, line, rowErrors, nil
+	}
+	return movie, line, nil, nil
+}
+
+// ndjsonMovieReader read one JSON movie per line, blank lines are skipped
+type ndjsonMovieReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newNDJSONMovieReader(r io.Reader) *ndjsonMovieReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), importMaxLineBytes)
+	return &ndjsonMovieReader{scanner: scanner}
+}
+
+func (r *ndjsonMovieReader) Read() (*data.Movie, int, map[string]string, error) {
+	for r.scanner.Scan() {
+		r.line++
+		line := bytes.TrimSpace(r.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var input struct {
+			Title   string       `json:"title"`
+			Year    int32        `json:"year"`
+			Runtime data.Runtime `json:"runtime"`
+			Genres  []string     `json:"genres"`
+		}
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.DisallowUnknownFields()
+		err := dec.Decode(&input)
+		if err != nil {
+			if p := errInvalidBody(err); p.Errors != nil {
+				return nil, r.line, p.Errors, nil
+			}
+			return nil, r.line, map[string]string{"row": "must be a JSON object"}, nil
+		}
+
+		movie := &data.Movie{
+			Title:   input.Title,
+			Year:    input.Year,
+			Runtime: input.Runtime,
+			Genres:  input.Genres,
+		}
+		return movie, r.line, nil, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return nil, 0, nil, errBadRequest(fmt.Sprintf("line %d is longer than %d bytes", r.line+1, importMaxLineBytes))
+		}
+		return nil, 0, nil, err
+	}
+	return nil, 0, nil, io.EOF
+}
+
+// importRowError report why a row of the import was rejected
+type importRowError struct {
+	Line   int               `json:"line"`
+	Errors map[string]string `json:"errors"`
+}
+
+type importReport struct {
+	DryRun    bool             `json:"dry_run"`
+	TotalRows int              `json:"total_rows"`
+	ValidRows int              `json:"valid_rows"`
+	Inserted  int              `json:"inserted"`
+	Errors    []importRowError `json:"errors"`
+}
+
+func (s *Server) importMoviesHandler(c *gin.Context) {
+	var input struct {
+		DryRun  bool   `form:"dry_run"`
+		OnError string `form:"on_error"`
+	}
+	input.OnError = "abort"
+	err := c.ShouldBindQuery(&input)
+	if err != nil {
+		s.errorResponse(c, errInvalidQuery(err))
+		return
+	}
+
+	v := validator.New()
+	v.Check(validator.In(input.OnError, "skip", "abort"), "on_error", "must be one of skip or abort")
+	if !v.Valid() {
+		s.errorResponse(c, errFailedValidation(v.Errors))
+		return
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, importMaxBytes)
+
+	var reader movieRowReader
+	switch c.ContentType() {
+	case "text/csv":
+		reader, err = newCSVMovieReader(body)
+		if err != nil {
+			s.errorResponse(c, errInvalidBody(err))
+			return
+		}
+	case "application/x-ndjson":
+		reader = newNDJSONMovieReader(body)
+	default:
+		s.errorResponse(c, errUnsupportedMediaType("the import must be text/csv or application/x-ndjson"))
+		return
+	}
+
+	// the whole stream is validated before anything is inserted, so that an
+	// aborted import leaves the catalogue untouched
+	report := importReport{DryRun: input.DryRun, Errors: []importRowError{}}
+	var movies []*data.Movie
+	for {
+		movie, line, rowErrors, err := reader.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			s.errorResponse(c, errInvalidBody(err))
+			return
+		}
+
+		report.TotalRows++
+		if report.TotalRows > importMaxRows {
+			s.errorResponse(c, errPayloadTooLarge(fmt.Sprintf("the import must not contain more than %d rows", importMaxRows)))
+			return
+		}
+
+		if rowErrors == nil {
+			v := validator.New()
+			if data.ValidateMovie(v, movie); !v.Valid() {
+				rowErrors = v.Errors
+			}
+		}
+		if rowErrors != nil {
+			report.Errors = append(report.Errors, importRowError{Line: line, Errors: rowErrors})
+			// a dry run keeps going so that every rejected row is reported
+			if input.OnError == "abort" && !input.DryRun {
+				s.errorResponse(c, errImportAborted(report.Errors[0]))
+				return
+			}
+			continue
+		}
+
+		report.ValidRows++
+		movies = append(movies, movie)
+	}
+
+	if input.DryRun {
+		c.JSON(http.StatusOK, gin.H{"import": report})
+		return
+	}
+
+	// the movies are inserted in one transaction, a failure leaves the
+	// catalogue untouched as well
+	err = s.models.Movies.InsertMany(c.Request.Context(), movies, s.contextGetUser(c).ID)
+	if err != nil {
+		s.errorResponse(c, err)
+		return
+	}
+	report.Inserted = len(movies)
+
+	c.JSON(http.StatusCreated, gin.H{"import": report})
+}
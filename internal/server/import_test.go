@@ -0,0 +1,81 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	logger "gin-project/internal/log"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCSVMovieReader(t *testing.T) {
+	stream := "Title,Year,Runtime,Genres\n" +
+		"Casablanca,1942,102,drama|romance\n" +
+		"Moana,abc,107 mins,animation\n" +
+		"Black Panther,2018\n"
+
+	reader, err := newCSVMovieReader(strings.NewReader(stream))
+	if err != nil {
+		t.Fatalf("newCSVMovieReader: %v", err)
+	}
+
+	movie, line, rowErrors, err := reader.Read()
+	if err != nil || rowErrors != nil {
+		t.Fatalf("row 1: got errors %v, %v", rowErrors, err)
+	}
+	if line != 2 || movie.Title != "Casablanca" || movie.Year != 1942 || movie.Runtime != 102 || len(movie.Genres) != 2 {
+		t.Errorf("row 1: got line %d, movie %+v", line, movie)
+	}
+
+	_, line, rowErrors, _ = reader.Read()
+	if line != 3 || rowErrors["year"] == "" || rowErrors["runtime"] != "" {
+		t.Errorf("row 2: got line %d, errors %v", line, rowErrors)
+	}
+
+	_, line, rowErrors, _ = reader.Read()
+	if line != 4 || rowErrors["row"] == "" {
+		t.Errorf("row 3: got line %d, errors %v", line, rowErrors)
+	}
+
+	_, _, _, err = reader.Read()
+	if !errors.Is(err, io.EOF) {
+		t.Errorf("got %v, want io.EOF", err)
+	}
+}
+
+func TestCSVMovieReaderHeader(t *testing.T) {
+	for _, header := range []string{"", "title,year,runtime\n", "title,year,runtime,genres,rating\n"} {
+		_, err := newCSVMovieReader(strings.NewReader(header))
+		if err == nil {
+			t.Errorf("header %q: expected an error", header)
+		}
+	}
+}
+
+func TestImportAborted(t *testing.T) {
+	s := &Server{logger: logger.New(io.Discard, logger.LevelInfo)}
+	r := gin.New()
+	r.POST("/v1/movies/import", s.importMoviesHandler)
+
+	stream := `{"title": "Casablanca", "year": 1942, "runtime": 102, "genres": ["drama"]}` + "\n" +
+		`{"title": "", "year": 2016, "runtime": 107, "genres": ["animation"]}` + "\n"
+	req := httptest.NewRequest(http.MethodPost, "/v1/movies/import", strings.NewReader(stream))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnprocessableEntity || rr.Header().Get("Content-Type") != "application/problem+json" {
+		t.Fatalf("got status %d and content type %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	var problem Problem
+	if err := json.Unmarshal(rr.Body.Bytes(), &problem); err != nil {
+		t.Fatal(err)
+	}
+	if problem.Code != "validation_failed" || problem.Errors["lines[2].title"] == "" {
+		t.Errorf("unexpected problem %+v", problem)
+	}
+}
@@ -1,21 +1,64 @@
 package server
 
 import (
+	"errors"
 	"fmt"
+	"gin-project/internal/data"
+	"gin-project/internal/validator"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"golang.org/x/time/rate"
 	"net"
+	"regexp"
+	"strings"
 	"sync"
 	"time"
 )
 
-func (s *Server) recoverPanic() gin.HandlerFunc {
+// requestIDRX restrict the request IDs accepted from clients, so that they can
+// be logged and echoed back safely
+var requestIDRX = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// requestLogger assign a request ID, reusing a valid X-Request-ID sent by the
+// client, store a logger tagged with it in the context and write one access
+// line once the request completes
+func (s *Server) requestLogger() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if err := recover(); err != nil {
-			s.errorLog.PrintError(fmt.Errorf("%s", err), nil)
-			s.serverErrorResponse(c, fmt.Errorf("%s", err))
-			c.Set("Connection", "close")
+		start := time.Now()
+
+		id := c.GetHeader("X-Request-ID")
+		if !requestIDRX.MatchString(id) {
+			id = uuid.New().String()
 		}
+		c.Header("X-Request-ID", id)
+		c.Set(requestIDContextKey, id)
+		c.Set(loggerContextKey, s.logger.With("request_id", id))
+
+		c.Next()
+
+		attrs := []any{
+			"method", c.Request.Method,
+			"route", c.FullPath(),
+			"status", c.Writer.Status(),
+			"latency_ms", float64(time.Since(start).Microseconds()) / 1000,
+			"bytes", max(c.Writer.Size(), 0),
+			"client_ip", c.ClientIP(),
+		}
+		if user, ok := c.Get(userContextKey); ok && !user.(*data.User).IsAnonymous() {
+			attrs = append(attrs, "user_id", user.(*data.User).ID.String())
+		}
+		s.contextGetLogger(c).Info("access", attrs...)
+	}
+}
+
+func (s *Server) recoverPanic() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if err := recover(); err != nil {
+				c.Header("Connection", "close")
+				s.errorResponse(c, errServer(fmt.Errorf("%s", err)))
+			}
+		}()
 		c.Next()
 	}
 }
@@ -48,7 +91,7 @@ func (s *Server) rateLimit() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ip, _, err := net.SplitHostPort(c.Request.RemoteAddr)
 		if err != nil {
-			s.serverErrorResponse(c, err)
+			s.errorResponse(c, err)
 			return
 		}
 		mu.Lock()
@@ -60,7 +103,7 @@ func (s *Server) rateLimit() gin.HandlerFunc {
 
 		if !clients[ip].limiter.Allow() {
 			mu.Unlock()
-			s.rateLimitExceededResponse(c)
+			s.errorResponse(c, errRateLimitExceeded())
 			return
 		}
 		mu.Unlock()
@@ -68,3 +111,91 @@ func (s *Server) rateLimit() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// authenticate resolve the bearer token from the Authorization header and store
+// the matching user (or the anonymous user) in the context
+func (s *Server) authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Vary", "Authorization")
+
+		authorizationHeader := c.GetHeader("Authorization")
+		if authorizationHeader == "" {
+			s.contextSetUser(c, data.AnonymousUser)
+			c.Next()
+			return
+		}
+
+		headerParts := strings.Split(authorizationHeader, " ")
+		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+			s.errorResponse(c, errInvalidAuthenticationToken())
+			return
+		}
+		token := headerParts[1]
+
+		v := validator.New()
+		if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+			s.errorResponse(c, errInvalidAuthenticationToken())
+			return
+		}
+
+		user, err := s.models.Users.GetForToken(c.Request.Context(), data.ScopeAuthentication, token)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				s.errorResponse(c, errInvalidAuthenticationToken())
+			default:
+				s.errorResponse(c, err)
+			}
+			return
+		}
+
+		s.contextSetUser(c, user)
+		c.Next()
+	}
+}
+
+// requireAuthenticatedUser reject requests from anonymous users
+func (s *Server) requireAuthenticatedUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := s.contextGetUser(c)
+		if user.IsAnonymous() {
+			s.errorResponse(c, errAuthenticationRequired())
+			return
+		}
+		c.Next()
+	}
+}
+
+// requireActivatedUser reject requests from anonymous or not yet activated
+// users before running next
+func (s *Server) requireActivatedUser(next gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := s.contextGetUser(c)
+		if user.IsAnonymous() {
+			s.errorResponse(c, errAuthenticationRequired())
+			return
+		}
+		if !user.Activated {
+			s.errorResponse(c, errInactiveAccount())
+			return
+		}
+		next(c)
+	}
+}
+
+// requirePermission reject requests from users who have not been granted the permission code
+func (s *Server) requirePermission(code string) gin.HandlerFunc {
+	return s.requireActivatedUser(func(c *gin.Context) {
+		user := s.contextGetUser(c)
+		permissions, err := s.models.Permissions.GetAllForUser(c.Request.Context(), user.ID)
+		if err != nil {
+			s.errorResponse(c, err)
+			return
+		}
+		if !permissions.Include(code) {
+			s.errorResponse(c, errNotPermitted())
+			return
+		}
+		c.Next()
+	})
+}
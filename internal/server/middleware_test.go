@@ -0,0 +1,62 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	logger "gin-project/internal/log"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestLogger(t *testing.T) {
+	var out bytes.Buffer
+	s := &Server{logger: logger.New(&out, logger.LevelInfo)}
+
+	r := gin.New()
+	r.Use(s.requestLogger())
+	r.GET("/v1/movies/:id", func(c *gin.Context) {
+		s.contextGetLogger(c).Info("handled")
+		c.String(http.StatusTeapot, "short")
+	})
+
+	for header, keep := range map[string]bool{"trace-42": true, "": false, "bad id\n": false} {
+		out.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/v1/movies/7", nil)
+		req.Header.Set("X-Request-ID", header)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+
+		id := rr.Header().Get("X-Request-ID")
+		if keep && id != header || !keep && (id == "" || id == header) {
+			t.Errorf("X-Request-ID %q: got response ID %q", header, id)
+		}
+
+		var entries []struct {
+			Message    string         `json:"message"`
+			Properties map[string]any `json:"properties"`
+		}
+		for _, line := range bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n")) {
+			var entry struct {
+				Message    string         `json:"message"`
+				Properties map[string]any `json:"properties"`
+			}
+			if err := json.Unmarshal(line, &entry); err != nil {
+				t.Fatalf("invalid log line %q", line)
+			}
+			entries = append(entries, entry)
+		}
+		if len(entries) != 2 {
+			t.Fatalf("expected the handler line and the access line, got %d lines", len(entries))
+		}
+		if entries[0].Properties["request_id"] != id {
+			t.Errorf("handler line not tagged with the request ID: %v", entries[0].Properties)
+		}
+		access := entries[1].Properties
+		if entries[1].Message != "access" || access["request_id"] != id || access["route"] != "/v1/movies/:id" ||
+			access["status"] != 418.0 || access["bytes"] != 5.0 || access["method"] != "GET" {
+			t.Errorf("unexpected access line %v", entries[1])
+		}
+	}
+}
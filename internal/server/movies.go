@@ -1,12 +1,17 @@
 package server
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"gin-project/internal/data"
+	"gin-project/internal/patch"
 	"gin-project/internal/validator"
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
+	"io"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
@@ -20,169 +25,396 @@ func (s *Server) health(c *gin.Context) {
 }
 
 func (s *Server) healthHandler(c *gin.Context) {
-	c.JSON(http.StatusOK, s.db.Health())
+	stats := s.db.Health()
+	if s.logBuffer != nil {
+		stats["log_dropped_entries"] = strconv.FormatUint(s.logBuffer.Dropped(), 10)
+	}
+	c.JSON(http.StatusOK, stats)
 }
 
 func (s *Server) createMovieHandler(c *gin.Context) {
 	var movie data.Movie
 	err := c.ShouldBindJSON(&movie)
 	if err != nil {
-		s.errorResponse(c, http.StatusBadRequest, err.Error())
+		s.errorResponse(c, errInvalidBody(err))
 		return
 	}
 	v := validator.New()
 	if data.ValidateMovie(v, &movie); !v.Valid() {
-		s.errorResponse(c, http.StatusBadRequest, v.Errors)
+		s.errorResponse(c, errFailedValidation(v.Errors))
 		return
 	}
 
 	// save to db
-	s.models.Movies.Insert(c.Request.Context(), &movie)
+	err = s.models.Movies.Insert(c.Request.Context(), &movie, s.contextGetUser(c).ID)
+	if err != nil {
+		s.errorResponse(c, err)
+		return
+	}
 
+	c.Header("ETag", versionETag(movie.Version))
 	c.JSON(http.StatusCreated, movie)
 }
 
 func (s *Server) showMovieHandler(c *gin.Context) {
-	id := c.Param("id")
-	_, err := uuid.Parse(id)
-	if err != nil {
-		s.errorResponse(c, http.StatusBadRequest, err.Error())
+	id, ok := s.readUUIDParam(c, "id")
+	if !ok {
 		return
 	}
-	movie, err := s.models.Movies.Get(c.Request.Context(), id)
+	movie, err := s.models.Movies.Get(c.Request.Context(), id.String())
 	if err != nil {
-		if errors.Is(err, data.ErrRecordNotFound) {
-			s.notFoundResponse(c)
-			return
-		}
-		s.errorLog.PrintError(err, nil)
-		s.errorResponse(c, http.StatusBadRequest, err.Error())
+		s.errorResponse(c, err)
+		return
+	}
+
+	c.Header("ETag", versionETag(movie.Version))
+	if version, ok := parseVersionETag(c.GetHeader("If-None-Match")); ok && version == movie.Version {
+		c.Status(http.StatusNotModified)
 		return
 	}
 	c.JSON(http.StatusOK, movie)
 }
 
+// updateMovieHandler fully replace the movie, every field must be provided
 func (s *Server) updateMovieHandler(c *gin.Context) {
-	id := c.Param("id")
+	id, ok := s.readUUIDParam(c, "id")
+	if !ok {
+		return
+	}
 	var input struct {
-		Title   *string       `json:"title"`
-		Year    *int32        `json:"year"`
-		Runtime *data.Runtime `json:"runtime"`
-		Genres  []string      `json:"genres"`
+		Title   string       `json:"title"`
+		Year    int32        `json:"year"`
+		Runtime data.Runtime `json:"runtime"`
+		Genres  []string     `json:"genres"`
+		Version *int32       `json:"version"`
 	}
 	err := c.ShouldBindJSON(&input)
 	if err != nil {
-		s.errorLog.PrintError(err, nil)
-		s.errorResponse(c, http.StatusBadRequest, err.Error())
+		s.errorResponse(c, errInvalidBody(err))
+		return
+	}
+
+	movie, err := s.models.Movies.Get(c.Request.Context(), id.String())
+	if err != nil {
+		s.errorResponse(c, err)
+		return
+	}
+
+	if !s.checkVersion(c, movie.Version, input.Version) {
+		return
+	}
+
+	movie.Title = input.Title
+	movie.Year = input.Year
+	movie.Runtime = input.Runtime
+	movie.Genres = input.Genres
+
+	s.saveMovie(c, movie)
+}
+
+// patchMovieHandler partially update the movie from either a JSON Merge Patch
+// (RFC 7396) or a JSON Patch (RFC 6902) document
+func (s *Server) patchMovieHandler(c *gin.Context) {
+	id, ok := s.readUUIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, 1_048_576))
+	if err != nil {
+		s.errorResponse(c, errInvalidBody(err))
 		return
 	}
 
-	movie, err := s.models.Movies.Get(c.Request.Context(), id)
+	movie, err := s.models.Movies.Get(c.Request.Context(), id.String())
 	if err != nil {
-		if errors.Is(err, data.ErrRecordNotFound) {
-			s.notFoundResponse(c)
+		s.errorResponse(c, err)
+		return
+	}
+
+	doc, err := json.Marshal(map[string]any{
+		"title":   movie.Title,
+		"year":    movie.Year,
+		"runtime": movie.Runtime,
+		"genres":  movie.Genres,
+		"version": movie.Version,
+	})
+	if err != nil {
+		s.errorResponse(c, err)
+		return
+	}
+
+	var patched moviePatchDocument
+	// versionInPatch is set when the patch itself carries the expected version,
+	// through a "version" member or a test operation on /version
+	versionInPatch := false
+
+	switch c.ContentType() {
+	case "application/merge-patch+json":
+		var members map[string]json.RawMessage
+		err = json.Unmarshal(body, &members)
+		if err != nil {
+			s.errorResponse(c, errBadRequest("body must be a JSON object"))
+			return
+		}
+		_, versionInPatch = members["version"]
+
+		doc, err = patch.Merge(doc, body)
+		if err != nil {
+			s.errorResponse(c, errInvalidBody(err))
 			return
 		}
-		s.errorLog.PrintError(err, nil)
-		s.errorResponse(c, http.StatusBadRequest, err.Error())
+		err = patched.decode(doc)
+		if err != nil {
+			s.errorResponse(c, errInvalidBody(err))
+			return
+		}
+	case "application/json-patch+json":
+		ops, err := patch.DecodeOperations(body)
+		if err != nil {
+			s.errorResponse(c, errBadRequest("body must be a JSON array of patch operations"))
+			return
+		}
+
+		for _, op := range ops {
+			if op.Op == "test" && op.Path == "/version" {
+				versionInPatch = true
+			}
+		}
+
+		// the patch is atomic (RFC 6902), the operations may go through an
+		// invalid movie as long as the movie they result in is valid
+		doc, err = patch.Apply(doc, ops)
+		if err != nil {
+			var opErr *patch.OperationError
+			switch {
+			case !errors.As(err, &opErr):
+				s.errorResponse(c, err)
+			case errors.Is(err, patch.ErrTestFailed) && opErr.Op.Path == "/version":
+				s.errorResponse(c, errEditConflict())
+			case errors.Is(err, patch.ErrTestFailed):
+				s.errorResponse(c, errConflict("patch_test_failed", fmt.Sprintf("operation %d: %s", opErr.Index, opErr.Err.Error())))
+			default:
+				s.errorResponse(c, errFailedValidation(map[string]string{fmt.Sprintf("operations[%d]", opErr.Index): opErr.Err.Error()}))
+			}
+			return
+		}
+
+		var errs map[string]string
+		err = patched.decode(doc)
+		if err != nil {
+			errs = errInvalidBody(err).Errors
+			if errs == nil {
+				errs = map[string]string{"operations": "must result in a movie"}
+			}
+		} else {
+			errs = patched.validate(*movie)
+		}
+		if len(errs) > 0 {
+			s.errorResponse(c, errFailedValidation(operationErrors(ops, errs)))
+			return
+		}
+	default:
+		c.Header("Accept-Patch", "application/merge-patch+json, application/json-patch+json")
+		s.errorResponse(c, errUnsupportedMediaType("unsupported patch format"))
 		return
 	}
 
-	movie.ID, err = uuid.Parse(id)
-	if err != nil {
-		s.errorLog.PrintError(err, nil)
-		s.errorResponse(c, http.StatusBadRequest, err.Error())
+	var patchVersion *int32
+	if versionInPatch {
+		patchVersion = &patched.Version
+	}
+	if !s.checkVersion(c, movie.Version, patchVersion) {
 		return
 	}
 
-	if input.Title != nil {
-		movie.Title = *input.Title
+	patched.applyTo(movie)
+
+	s.saveMovie(c, movie)
+}
+
+// moviePatchDocument is the JSON representation of a movie that patches are applied to
+type moviePatchDocument struct {
+	Title   string       `json:"title"`
+	Year    int32        `json:"year"`
+	Runtime data.Runtime `json:"runtime"`
+	Genres  []string     `json:"genres"`
+	Version int32        `json:"version"`
+}
+
+func (d *moviePatchDocument) decode(doc []byte) error {
+	*d = moviePatchDocument{}
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.DisallowUnknownFields()
+	return dec.Decode(d)
+}
+
+func (d *moviePatchDocument) applyTo(movie *data.Movie) {
+	movie.Title = d.Title
+	movie.Year = d.Year
+	movie.Runtime = d.Runtime
+	movie.Genres = d.Genres
+}
+
+// validate run data.ValidateMovie against movie with the patched fields, it
+// returns the errors by field
+func (d *moviePatchDocument) validate(movie data.Movie) map[string]string {
+	d.applyTo(&movie)
+	v := validator.New()
+	data.ValidateMovie(v, &movie)
+	return v.Errors
+}
+
+// operationErrors key the errors of the patched movie by the last operation
+// which changed their field, such as operations[2].title, the errors of
+// fields no operation changed keep their key
+func operationErrors(ops []patch.Operation, errs map[string]string) map[string]string {
+	v := validator.New()
+	for field, message := range errs {
+		key := field
+		for i := len(ops) - 1; i >= 0; i-- {
+			if changesField(ops[i], field) {
+				key = fmt.Sprintf("operations[%d].%s", i, field)
+				break
+			}
+		}
+		v.AddError(key, message)
 	}
-	// year
-	if input.Year != nil {
-		movie.Year = *input.Year
+	return v.Errors
+}
+
+// changesField report whether the operation writes to the field, or removes it
+// by moving it elsewhere
+func changesField(op patch.Operation, field string) bool {
+	within := func(path string) bool {
+		return path == "" || path == "/"+field || strings.HasPrefix(path, "/"+field+"/")
 	}
-	// runtime
-	if input.Runtime != nil {
-		movie.Runtime = *input.Runtime
+	if op.Op == "test" {
+		return false
 	}
-	// genres
-	if len(input.Genres) > 0 {
-		movie.Genres = input.Genres
+	return within(op.Path) || (op.Op == "move" && within(op.From))
+}
+
+// checkVersion make sure the client is editing the latest version of a record,
+// the expected version comes from the If-Match header and/or the request body
+func (s *Server) checkVersion(c *gin.Context, current int32, bodyVersion *int32) bool {
+	ifMatch := c.GetHeader("If-Match")
+	if ifMatch == "" && bodyVersion == nil {
+		s.errorResponse(c, errPreconditionRequired())
+		return false
 	}
-	// validate
+	if ifMatch != "" {
+		version, ok := parseVersionETag(ifMatch)
+		if !ok {
+			s.errorResponse(c, errBadRequest("invalid If-Match header"))
+			return false
+		}
+		if version != current {
+			s.errorResponse(c, errEditConflict())
+			return false
+		}
+	}
+	if bodyVersion != nil && *bodyVersion != current {
+		s.errorResponse(c, errEditConflict())
+		return false
+	}
+	return true
+}
+
+// saveMovie validate and persist the updated movie then write it to the response
+func (s *Server) saveMovie(c *gin.Context, movie *data.Movie) {
 	v := validator.New()
 	if data.ValidateMovie(v, movie); !v.Valid() {
-		s.errorLog.PrintError(err, nil)
-		s.errorResponse(c, http.StatusBadRequest, err.Error())
+		s.errorResponse(c, errFailedValidation(v.Errors))
 		return
 	}
 
-	// update
-	err = s.models.Movies.Update(c.Request.Context(), movie)
+	err := s.models.Movies.Update(c.Request.Context(), movie, s.contextGetUser(c).ID)
 	if err != nil {
-		s.errorResponse(c, http.StatusBadRequest, err.Error())
+		s.errorResponse(c, err)
 		return
 	}
+	c.Header("ETag", versionETag(movie.Version))
 	c.JSON(http.StatusOK, movie)
 }
 
 func (s *Server) deleteMovieHandler(c *gin.Context) {
 	// get id
-	id := c.Param("id")
-	_, err := uuid.Parse(id)
-	if err != nil {
-		s.errorLog.PrintError(err, nil)
-		s.errorResponse(c, http.StatusBadRequest, err.Error())
+	id, ok := s.readUUIDParam(c, "id")
+	if !ok {
 		return
 	}
 	// delete
-	err = s.models.Movies.Delete(c.Request.Context(), id)
+	err := s.models.Movies.Delete(c.Request.Context(), id.String(), s.contextGetUser(c).ID)
 	if err != nil {
-		if errors.Is(err, data.ErrRecordNotFound) {
-			s.notFoundResponse(c)
-			return
-		}
-		s.errorResponse(c, http.StatusBadRequest, err.Error())
+		s.errorResponse(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "movie deleted"})
+	c.JSON(http.StatusOK, gin.H{"message": "movie moved to the trash"})
 }
 
 func (s *Server) listMoviesHandler(c *gin.Context) {
 	var input struct {
-		Title  string   `form:"title" default:""`
-		Genres []string `form:"genres"`
+		data.MovieFilters
 		data.Filters
+		Facets []string `form:"facets"`
 	}
+	input.MovieFilters = data.NewMovieFilters()
 	input.Filters = data.NewFilters()
-	input.Filters.SortSafelist = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}
+	input.Filters.SortSafelist = []string{"id", "title", "year", "runtime", "relevance", "average_rating", "rating_count",
+		"-id", "-title", "-year", "-runtime", "-average_rating", "-rating_count"}
+	input.Filters.CursorSecret = []byte(s.config.cursor.secret)
 	// bind
 	err := c.ShouldBindQuery(&input)
 	if err != nil {
-		s.errorResponse(c, http.StatusBadRequest, err.Error())
+		s.errorResponse(c, errInvalidQuery(err))
 		return
 	}
 	if len(input.Genres) > 0 {
 		input.Genres = strings.Split(input.Genres[0], ",")
 	}
+	if len(input.ExcludeGenres) > 0 {
+		input.ExcludeGenres = strings.Split(input.ExcludeGenres[0], ",")
+	}
+	if len(input.Facets) > 0 {
+		input.Facets = strings.Split(input.Facets[0], ",")
+	}
 
 	v := validator.New()
+	data.ValidateMovieFilters(v, input.MovieFilters)
+	for _, facet := range input.Facets {
+		v.Check(validator.In(facet, data.MovieFacetSafelist...), "facets", "invalid facet value")
+	}
 	if data.ValidateFilters(v, input.Filters); !v.Valid() {
-		s.errorResponse(c, http.StatusBadRequest, v.Errors)
+		s.errorResponse(c, errFailedValidation(v.Errors))
 		return
 	}
 
 	// get movies
-	movies, err := s.models.Movies.List(c.Request.Context(), input.Title, input.Genres, &input.Filters)
+	movies, metadata, err := s.models.Movies.List(c.Request.Context(), input.MovieFilters, &input.Filters)
 	if err != nil {
-		s.errorResponse(c, http.StatusBadRequest, err.Error())
+		switch {
+		case errors.Is(err, data.ErrInvalidCursor):
+			s.errorResponse(c, errFailedValidation(map[string]string{"cursor": "invalid or tampered cursor"}))
+		case errors.Is(err, data.ErrCursorMismatch):
+			s.errorResponse(c, errBadRequest("the cursor was issued for other filters, the listing must be started again without it"))
+		default:
+			s.errorResponse(c, err)
+		}
 		return
 	}
 
+	if len(input.Facets) > 0 {
+		metadata.Facets, err = s.models.Movies.Facets(c.Request.Context(), input.MovieFilters, input.Facets)
+		if err != nil {
+			s.errorResponse(c, err)
+			return
+		}
+	}
+
 	response := map[string]interface{}{
 		"movies":   movies,
-		"metadata": input,
+		"metadata": metadata,
 	}
 
 	c.JSON(http.StatusOK, response)
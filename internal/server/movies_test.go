@@ -0,0 +1,134 @@
+package server
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"gin-project/internal/data"
+	"gin-project/internal/database"
+	logger "gin-project/internal/log"
+	"gin-project/internal/patch"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMoviePatchDocumentValidate(t *testing.T) {
+	movie := data.Movie{Title: "Casablanca", Year: 1942, Runtime: 102, Genres: []string{"drama"}}
+
+	d := moviePatchDocument{Title: movie.Title, Year: movie.Year, Runtime: movie.Runtime, Genres: movie.Genres}
+	if errs := d.validate(movie); len(errs) != 0 {
+		t.Errorf("unexpected errors for a valid movie: %v", errs)
+	}
+
+	d.Title = ""
+	d.Genres = []string{}
+	errs := d.validate(movie)
+	if errs["title"] == "" || errs["genres"] == "" || len(errs) != 2 {
+		t.Errorf("expected title and genres errors, got %v", errs)
+	}
+	if movie.Title != "Casablanca" {
+		t.Error("validate must not modify the movie")
+	}
+}
+
+func TestOperationErrors(t *testing.T) {
+	ops := []patch.Operation{
+		{Op: "replace", Path: "/title", Value: json.RawMessage(`""`)},
+		{Op: "remove", Path: "/genres/0"},
+		{Op: "test", Path: "/genres"},
+		{Op: "move", From: "/year", Path: "/runtime"},
+	}
+	errs := operationErrors(ops, map[string]string{
+		"title":   "must be provided",
+		"genres":  "must contain at least 1 genre",
+		"year":    "must be provided",
+		"runtime": "must be a positive integer",
+		"version": "must be provided",
+	})
+
+	want := map[string]string{
+		"operations[0].title":   "must be provided",
+		"operations[1].genres":  "must contain at least 1 genre",
+		"operations[3].year":    "must be provided",
+		"operations[3].runtime": "must be a positive integer",
+		"version":               "must be provided",
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("got %v, want %v", errs, want)
+	}
+	for key, message := range want {
+		if errs[key] != message {
+			t.Errorf("%s = %q, want %q", key, errs[key], message)
+		}
+	}
+}
+
+func TestPatchMovieHandlerIsAtomic(t *testing.T) {
+	movieID := uuid.New()
+	created := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	var updates [][]driver.NamedValue
+	db := newFakeDB(func(query string, args []driver.NamedValue) ([]string, [][]driver.Value, error) {
+		switch {
+		case strings.Contains(query, "UPDATE movies"):
+			updates = append(updates, args)
+			return []string{"version"}, [][]driver.Value{{int64(2)}}, nil
+		case strings.Contains(query, "FROM movies"):
+			return []string{"id", "created_at", "title", "year", "runtime", "genres", "version", "average_rating", "rating_count"},
+				[][]driver.Value{{movieID.String(), created, "Casablanca", int64(1942), int64(102), []byte("{drama}"), int64(1), 0.0, int64(0)}}, nil
+		}
+		return nil, nil, errors.New("unexpected query " + query)
+	})
+
+	var svc database.Service = db
+	s := &Server{models: data.NewModels(&svc), logger: logger.New(io.Discard, logger.LevelInfo)}
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		s.contextSetUser(c, &data.User{ID: uuid.New(), Activated: true})
+	})
+	r.PATCH("/v1/movies/:id", s.patchMovieHandler)
+
+	tests := []struct {
+		name     string
+		body     string
+		status   int
+		errorKey string
+	}{
+		// the movie has no genre between the two operations
+		{"intermediate state", `[{"op": "remove", "path": "/genres/0"}, {"op": "add", "path": "/genres/-", "value": "romance"}]`, http.StatusOK, ""},
+		{"invalid result", `[{"op": "add", "path": "/genres/-", "value": "romance"}, {"op": "remove", "path": "/genres/0"}, {"op": "remove", "path": "/genres/0"}]`, http.StatusUnprocessableEntity, "operations[2].genres"},
+		{"wrong type", `[{"op": "replace", "path": "/year", "value": "soon"}]`, http.StatusUnprocessableEntity, "operations[0].year"},
+	}
+
+	for _, tt := range tests {
+		updates = nil
+		req := httptest.NewRequest(http.MethodPatch, "/v1/movies/"+movieID.String(), strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json-patch+json")
+		req.Header.Set("If-Match", `"1"`)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+
+		if rr.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, rr.Code, tt.status, rr.Body.String())
+			continue
+		}
+		if tt.errorKey != "" {
+			var problem Problem
+			json.Unmarshal(rr.Body.Bytes(), &problem)
+			if problem.Errors[tt.errorKey] == "" {
+				t.Errorf("%s: expected a %s error, got %v", tt.name, tt.errorKey, problem.Errors)
+			}
+			if len(updates) != 0 {
+				t.Errorf("%s: the movie must not be updated", tt.name)
+			}
+		} else if len(updates) != 1 {
+			t.Errorf("%s: expected 1 update, got %d", tt.name, len(updates))
+		}
+	}
+}
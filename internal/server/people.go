@@ -0,0 +1,255 @@
+package server
+
+import (
+	"errors"
+	"gin-project/internal/data"
+	"gin-project/internal/validator"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"net/http"
+)
+
+func (s *Server) createPersonHandler(c *gin.Context) {
+	var input struct {
+		Name      string `json:"name"`
+		Biography string `json:"biography"`
+	}
+	err := c.ShouldBindJSON(&input)
+	if err != nil {
+		s.errorResponse(c, errInvalidBody(err))
+		return
+	}
+
+	person := &data.Person{
+		Name:      input.Name,
+		Biography: input.Biography,
+	}
+
+	v := validator.New()
+	if data.ValidatePerson(v, person); !v.Valid() {
+		s.errorResponse(c, errFailedValidation(v.Errors))
+		return
+	}
+
+	err = s.models.People.Insert(c.Request.Context(), person)
+	if err != nil {
+		s.errorResponse(c, err)
+		return
+	}
+
+	c.Header("ETag", versionETag(person.Version))
+	c.JSON(http.StatusCreated, gin.H{"person": person})
+}
+
+// getPerson load the person named in the path, it writes the error response
+// and returns nil when the person cannot be loaded
+func (s *Server) getPerson(c *gin.Context) *data.Person {
+	id, ok := s.readUUIDParam(c, "id")
+	if !ok {
+		return nil
+	}
+
+	person, err := s.models.People.Get(c.Request.Context(), id)
+	if err != nil {
+		s.errorResponse(c, err)
+		return nil
+	}
+	return person
+}
+
+func (s *Server) showPersonHandler(c *gin.Context) {
+	person := s.getPerson(c)
+	if person == nil {
+		return
+	}
+
+	c.Header("ETag", versionETag(person.Version))
+	c.JSON(http.StatusOK, gin.H{"person": person})
+}
+
+func (s *Server) updatePersonHandler(c *gin.Context) {
+	var input struct {
+		Name      string `json:"name"`
+		Biography string `json:"biography"`
+		Version   *int32 `json:"version"`
+	}
+	err := c.ShouldBindJSON(&input)
+	if err != nil {
+		s.errorResponse(c, errInvalidBody(err))
+		return
+	}
+
+	person := s.getPerson(c)
+	if person == nil {
+		return
+	}
+
+	if !s.checkVersion(c, person.Version, input.Version) {
+		return
+	}
+
+	person.Name = input.Name
+	person.Biography = input.Biography
+
+	v := validator.New()
+	if data.ValidatePerson(v, person); !v.Valid() {
+		s.errorResponse(c, errFailedValidation(v.Errors))
+		return
+	}
+
+	err = s.models.People.Update(c.Request.Context(), person)
+	if err != nil {
+		s.errorResponse(c, err)
+		return
+	}
+
+	c.Header("ETag", versionETag(person.Version))
+	c.JSON(http.StatusOK, gin.H{"person": person})
+}
+
+func (s *Server) deletePersonHandler(c *gin.Context) {
+	id, ok := s.readUUIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	err := s.models.People.Delete(c.Request.Context(), id)
+	if err != nil {
+		s.errorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "person deleted"})
+}
+
+func (s *Server) listPeopleHandler(c *gin.Context) {
+	var input struct {
+		Name string `form:"name"`
+		data.Filters
+	}
+	input.Filters = data.NewFilters()
+	input.Filters.Sort = "name"
+	input.Filters.SortSafelist = []string{"name", "created_at", "-name", "-created_at"}
+	err := c.ShouldBindQuery(&input)
+	if err != nil {
+		s.errorResponse(c, errInvalidQuery(err))
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		s.errorResponse(c, errFailedValidation(v.Errors))
+		return
+	}
+
+	people, metadata, err := s.models.People.List(c.Request.Context(), input.Name, input.Filters)
+	if err != nil {
+		s.errorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"people": people, "metadata": metadata})
+}
+
+func (s *Server) listMovieCreditsHandler(c *gin.Context) {
+	movieID, ok := s.readUUIDParam(c, "id")
+	if !ok {
+		return
+	}
+	if !s.movieExists(c, movieID) {
+		return
+	}
+
+	credits, err := s.models.Credits.GetAllForMovie(c.Request.Context(), movieID)
+	if err != nil {
+		s.errorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"credits": credits})
+}
+
+func (s *Server) createMovieCreditHandler(c *gin.Context) {
+	movieID, ok := s.readUUIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var input struct {
+		PersonID     string `json:"person_id"`
+		Role         string `json:"role"`
+		Character    string `json:"character"`
+		BillingOrder int32  `json:"billing_order"`
+	}
+	err := c.ShouldBindJSON(&input)
+	if err != nil {
+		s.errorResponse(c, errInvalidBody(err))
+		return
+	}
+
+	credit := &data.Credit{
+		MovieID:      movieID,
+		Role:         input.Role,
+		Character:    input.Character,
+		BillingOrder: input.BillingOrder,
+	}
+
+	v := validator.New()
+	if input.PersonID != "" {
+		credit.PersonID, err = uuid.Parse(input.PersonID)
+		v.Check(err == nil, "person_id", "must be a valid UUID")
+	}
+	if data.ValidateCredit(v, credit); !v.Valid() {
+		s.errorResponse(c, errFailedValidation(v.Errors))
+		return
+	}
+
+	if !s.movieExists(c, movieID) {
+		return
+	}
+
+	_, err = s.models.People.Get(c.Request.Context(), credit.PersonID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("person_id", "does not exist")
+			s.errorResponse(c, errFailedValidation(v.Errors))
+		default:
+			s.errorResponse(c, err)
+		}
+		return
+	}
+
+	err = s.models.Credits.Insert(c.Request.Context(), credit)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateCredit):
+			v.AddError("person_id", "is already credited with this role")
+			s.errorResponse(c, errDuplicate(v.Errors))
+		default:
+			s.errorResponse(c, err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"credit": credit})
+}
+
+func (s *Server) deleteMovieCreditHandler(c *gin.Context) {
+	movieID, ok := s.readUUIDParam(c, "id")
+	if !ok {
+		return
+	}
+	creditID, ok := s.readUUIDParam(c, "credit_id")
+	if !ok {
+		return
+	}
+
+	err := s.models.Credits.Delete(c.Request.Context(), movieID, creditID)
+	if err != nil {
+		s.errorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "credit deleted"})
+}
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"errors"
+	"gin-project/internal/data"
+	"gin-project/internal/validator"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"net/http"
+)
+
+// movieExists write a 404 response and returns false when the movie does not exist
+func (s *Server) movieExists(c *gin.Context, movieID uuid.UUID) bool {
+	_, err := s.models.Movies.Get(c.Request.Context(), movieID.String())
+	if err != nil {
+		s.errorResponse(c, err)
+		return false
+	}
+	return true
+}
+
+func (s *Server) listMovieReviewsHandler(c *gin.Context) {
+	movieID, ok := s.readUUIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	filters := data.NewFilters()
+	filters.Sort = "-created_at"
+	filters.SortSafelist = []string{"created_at", "rating", "-created_at", "-rating"}
+	err := c.ShouldBindQuery(&filters)
+	if err != nil {
+		s.errorResponse(c, errInvalidQuery(err))
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		s.errorResponse(c, errFailedValidation(v.Errors))
+		return
+	}
+
+	if !s.movieExists(c, movieID) {
+		return
+	}
+
+	reviews, metadata, err := s.models.Reviews.GetAllForMovie(c.Request.Context(), movieID, filters)
+	if err != nil {
+		s.errorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"reviews": reviews, "metadata": metadata})
+}
+
+func (s *Server) createMovieReviewHandler(c *gin.Context) {
+	movieID, ok := s.readUUIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Rating int32  `json:"rating"`
+		Body   string `json:"body"`
+	}
+	err := c.ShouldBindJSON(&input)
+	if err != nil {
+		s.errorResponse(c, errInvalidBody(err))
+		return
+	}
+
+	review := &data.Review{
+		MovieID: movieID,
+		UserID:  s.contextGetUser(c).ID,
+		Rating:  input.Rating,
+		Body:    input.Body,
+	}
+
+	v := validator.New()
+	if data.ValidateReview(v, review); !v.Valid() {
+		s.errorResponse(c, errFailedValidation(v.Errors))
+		return
+	}
+
+	if !s.movieExists(c, movieID) {
+		return
+	}
+
+	err = s.models.Reviews.Insert(c.Request.Context(), review)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateReview):
+			v.AddError("movie_id", "you have already reviewed this movie")
+			s.errorResponse(c, errDuplicate(v.Errors))
+		default:
+			s.errorResponse(c, err)
+		}
+		return
+	}
+
+	c.Header("ETag", versionETag(review.Version))
+	c.JSON(http.StatusCreated, gin.H{"review": review})
+}
+
+// getMovieReview load the review named in the path, it writes the error
+// response and returns nil when the review cannot be loaded
+func (s *Server) getMovieReview(c *gin.Context) *data.Review {
+	movieID, ok := s.readUUIDParam(c, "id")
+	if !ok {
+		return nil
+	}
+	reviewID, ok := s.readUUIDParam(c, "review_id")
+	if !ok {
+		return nil
+	}
+
+	review, err := s.models.Reviews.Get(c.Request.Context(), movieID, reviewID)
+	if err != nil {
+		s.errorResponse(c, err)
+		return nil
+	}
+	return review
+}
+
+func (s *Server) showMovieReviewHandler(c *gin.Context) {
+	review := s.getMovieReview(c)
+	if review == nil {
+		return
+	}
+
+	c.Header("ETag", versionETag(review.Version))
+	c.JSON(http.StatusOK, gin.H{"review": review})
+}
+
+func (s *Server) updateMovieReviewHandler(c *gin.Context) {
+	var input struct {
+		Rating  int32  `json:"rating"`
+		Body    string `json:"body"`
+		Version *int32 `json:"version"`
+	}
+	err := c.ShouldBindJSON(&input)
+	if err != nil {
+		s.errorResponse(c, errInvalidBody(err))
+		return
+	}
+
+	review := s.getMovieReview(c)
+	if review == nil {
+		return
+	}
+
+	// only the author can edit a review
+	if review.UserID != s.contextGetUser(c).ID {
+		s.errorResponse(c, errNotPermitted())
+		return
+	}
+
+	if !s.checkVersion(c, review.Version, input.Version) {
+		return
+	}
+
+	review.Rating = input.Rating
+	review.Body = input.Body
+
+	v := validator.New()
+	if data.ValidateReview(v, review); !v.Valid() {
+		s.errorResponse(c, errFailedValidation(v.Errors))
+		return
+	}
+
+	err = s.models.Reviews.Update(c.Request.Context(), review)
+	if err != nil {
+		s.errorResponse(c, err)
+		return
+	}
+
+	c.Header("ETag", versionETag(review.Version))
+	c.JSON(http.StatusOK, gin.H{"review": review})
+}
+
+func (s *Server) deleteMovieReviewHandler(c *gin.Context) {
+	review := s.getMovieReview(c)
+	if review == nil {
+		return
+	}
+
+	// besides the author, users allowed to edit the catalogue can moderate reviews
+	user := s.contextGetUser(c)
+	if review.UserID != user.ID {
+		permissions, err := s.models.Permissions.GetAllForUser(c.Request.Context(), user.ID)
+		if err != nil {
+			s.errorResponse(c, err)
+			return
+		}
+		if !permissions.Include("movies:write") {
+			s.errorResponse(c, errNotPermitted())
+			return
+		}
+	}
+
+	err := s.models.Reviews.Delete(c.Request.Context(), review.ID)
+	if err != nil {
+		s.errorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "review deleted"})
+}
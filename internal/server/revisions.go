@@ -0,0 +1,117 @@
+package server
+
+import (
+	"gin-project/internal/data"
+	"gin-project/internal/validator"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+func (s *Server) listMovieHistoryHandler(c *gin.Context) {
+	movieID, ok := s.readUUIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	filters := data.NewFilters()
+	filters.Sort = "-created_at"
+	filters.SortSafelist = []string{"-created_at"}
+	err := c.ShouldBindQuery(&filters)
+	if err != nil {
+		s.errorResponse(c, errInvalidQuery(err))
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		s.errorResponse(c, errFailedValidation(v.Errors))
+		return
+	}
+
+	if !s.movieExists(c, movieID) {
+		return
+	}
+
+	revisions, metadata, err := s.models.Revisions.GetAllForMovie(c.Request.Context(), movieID, filters)
+	if err != nil {
+		s.errorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"revisions": revisions, "metadata": metadata})
+}
+
+// getMovieRevision load the revision which produced the version named by
+// value, it writes the error response and returns nil when it cannot be loaded
+func (s *Server) getMovieRevision(c *gin.Context, value string) *data.Revision {
+	movieID, ok := s.readUUIDParam(c, "id")
+	if !ok {
+		return nil
+	}
+
+	version, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || version < 1 {
+		s.errorResponse(c, errNotFound())
+		return nil
+	}
+
+	revision, err := s.models.Revisions.GetVersion(c.Request.Context(), movieID, int32(version))
+	if err != nil {
+		s.errorResponse(c, err)
+		return nil
+	}
+	return revision
+}
+
+func (s *Server) showMovieRevisionHandler(c *gin.Context) {
+	revision := s.getMovieRevision(c, c.Param("version"))
+	if revision == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"revision": revision})
+}
+
+// revertMovieHandler restore the movie to the state it had at the version given
+// in the query string, as a regular update which goes through validation and
+// the version check and creates a new version
+func (s *Server) revertMovieHandler(c *gin.Context) {
+	var input struct {
+		Version *int32 `json:"version"`
+	}
+	if c.Request.ContentLength != 0 {
+		err := c.ShouldBindJSON(&input)
+		if err != nil {
+			s.errorResponse(c, errInvalidBody(err))
+			return
+		}
+	}
+
+	if c.Query("version") == "" {
+		s.errorResponse(c, errFailedValidation(map[string]string{"version": "must be provided"}))
+		return
+	}
+
+	revision := s.getMovieRevision(c, c.Query("version"))
+	if revision == nil {
+		return
+	}
+
+	movie, err := s.models.Movies.Get(c.Request.Context(), revision.MovieID.String())
+	if err != nil {
+		s.errorResponse(c, err)
+		return
+	}
+
+	if !s.checkVersion(c, movie.Version, input.Version) {
+		return
+	}
+
+	movie.Title = revision.After.Title
+	movie.Year = revision.After.Year
+	movie.Runtime = revision.After.Runtime
+	movie.Genres = revision.After.Genres
+
+	s.saveMovie(c, movie)
+}
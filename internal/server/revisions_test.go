@@ -0,0 +1,197 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"gin-project/internal/data"
+	"gin-project/internal/database"
+	logger "gin-project/internal/log"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeQuery answer a statement with the columns and rows to return, nil
+// columns mean no rows
+type fakeQuery func(query string, args []driver.NamedValue) ([]string, [][]driver.Value, error)
+
+// fakeDB is a database.Service backed by a driver which routes every
+// statement to a fakeQuery, it lets handlers run without postgres
+type fakeDB struct {
+	db *sql.DB
+}
+
+func newFakeDB(query fakeQuery) *fakeDB {
+	return &fakeDB{db: sql.OpenDB(fakeConnector{query})}
+}
+
+func (f *fakeDB) Health() map[string]string { return map[string]string{"status": "up"} }
+func (f *fakeDB) Close() error              { return f.db.Close() }
+func (f *fakeDB) DB() *sql.DB               { return f.db }
+
+type fakeConnector struct{ query fakeQuery }
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) { return fakeConn(c), nil }
+func (c fakeConnector) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{ query fakeQuery }
+
+func (c fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c fakeConn) Close() error                        { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)           { return fakeTx{}, nil }
+
+func (c fakeConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	return fakeTx{}, nil
+}
+
+// fakeTx let the models open transactions, the statements are not isolated
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+func (c fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	_, rows, err := c.query(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(len(rows)), nil
+}
+
+func (c fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	columns, rows, err := c.query(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{columns: columns, rows: rows}, nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func TestRevertMovieHandler(t *testing.T) {
+	movieID := uuid.New()
+	userID := uuid.New()
+	created := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	// the movie is at version 2, version 1 is the state the tests revert to
+	revisions := map[int64]string{
+		1: `{"title": "Casablanca", "year": 1942, "runtime": 102, "genres": ["drama"], "version": 1}`,
+		// a snapshot which no longer passes validation
+		3: `{"title": "Casablanca", "year": 1942, "runtime": 102, "genres": [], "version": 3}`,
+	}
+
+	tests := []struct {
+		name     string
+		target   string
+		ifMatch  string
+		status   int
+		updated  bool
+		errorKey string
+	}{
+		{"revert", "1", `"2"`, http.StatusOK, true, ""},
+		{"stale version", "1", `"1"`, http.StatusConflict, false, ""},
+		{"missing version", "1", "", http.StatusPreconditionRequired, false, ""},
+		{"invalid snapshot", "3", `"2"`, http.StatusUnprocessableEntity, false, "genres"},
+		{"unknown version", "9", `"2"`, http.StatusNotFound, false, ""},
+	}
+
+	for _, tt := range tests {
+		var updates [][]driver.NamedValue
+		var updateQuery string
+		db := newFakeDB(func(query string, args []driver.NamedValue) ([]string, [][]driver.Value, error) {
+			switch {
+			case strings.Contains(query, "FROM movie_revisions"):
+				after, ok := revisions[args[1].Value.(int64)]
+				if !ok {
+					return nil, nil, nil
+				}
+				return []string{"id", "created_at", "movie_id", "version", "operation", "before", "after", "user_id"},
+					[][]driver.Value{{uuid.NewString(), created, movieID.String(), args[1].Value, "update", nil, []byte(after), nil}}, nil
+			case strings.Contains(query, "UPDATE movies"):
+				updateQuery = query
+				updates = append(updates, args)
+				return []string{"version"}, [][]driver.Value{{int64(3)}}, nil
+			case strings.Contains(query, "FROM movies"):
+				return []string{"id", "created_at", "title", "year", "runtime", "genres", "version", "average_rating", "rating_count"},
+					[][]driver.Value{{movieID.String(), created, "Casablanca (colorized)", int64(1991), int64(120), []byte("{drama,romance}"), int64(2), 0.0, int64(0)}}, nil
+			}
+			return nil, nil, errors.New("unexpected query " + query)
+		})
+
+		var svc database.Service = db
+		s := &Server{models: data.NewModels(&svc), logger: logger.New(io.Discard, logger.LevelInfo)}
+		r := gin.New()
+		r.Use(func(c *gin.Context) {
+			s.contextSetUser(c, &data.User{ID: userID, Activated: true})
+		})
+		r.POST("/v1/movies/:id/revert", s.revertMovieHandler)
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/movies/"+movieID.String()+"/revert?version="+tt.target, nil)
+		if tt.ifMatch != "" {
+			req.Header.Set("If-Match", tt.ifMatch)
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+
+		if rr.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, rr.Code, tt.status, rr.Body.String())
+		}
+		if tt.errorKey != "" {
+			var problem Problem
+			json.Unmarshal(rr.Body.Bytes(), &problem)
+			if problem.Errors[tt.errorKey] == "" {
+				t.Errorf("%s: expected a %s error, got %v", tt.name, tt.errorKey, problem.Errors)
+			}
+		}
+		if !tt.updated {
+			if len(updates) != 0 {
+				t.Errorf("%s: the movie must not be updated", tt.name)
+			}
+			continue
+		}
+
+		// the revert is a regular update, recorded as an update revision by
+		// the same statement
+		if len(updates) != 1 {
+			t.Fatalf("%s: expected 1 update, got %d", tt.name, len(updates))
+		}
+		if !strings.Contains(updateQuery, "INSERT INTO movie_revisions") || !strings.Contains(updateQuery, "'update'") {
+			t.Errorf("%s: the update does not record an update revision: %s", tt.name, updateQuery)
+		}
+		args := updates[0]
+		if args[0].Value != "Casablanca" || args[1].Value != int64(1942) || args[2].Value != int64(102) {
+			t.Errorf("%s: movie not reverted to version 1: %v", tt.name, args[:4])
+		}
+		if args[5].Value != int64(2) || args[6].Value != userID.String() {
+			t.Errorf("%s: expected version 2 updated by %s, got %v", tt.name, userID, args[5:])
+		}
+		var movie data.Movie
+		json.Unmarshal(rr.Body.Bytes(), &movie)
+		if movie.Version != 3 || rr.Header().Get("ETag") != `"3"` {
+			t.Errorf("%s: expected the new version 3, got %d and ETag %s", tt.name, movie.Version, rr.Header().Get("ETag"))
+		}
+	}
+}
@@ -7,21 +7,85 @@ import (
 )
 
 func (s *Server) RegisterRoutes() http.Handler {
-	r := gin.Default()
+	r := gin.New()
+	r.Use(s.requestLogger())
 	r.Use(s.recoverPanic())
 	r.Use(s.rateLimit())
+	r.Use(s.authenticate())
+
+	r.HandleMethodNotAllowed = true
+	r.NoRoute(func(c *gin.Context) {
+		s.errorResponse(c, errNotFound())
+	})
+	r.NoMethod(func(c *gin.Context) {
+		s.errorResponse(c, errMethodNotAllowed(c.Request.Method))
+	})
 
 	r.GET("/", s.health)
 	r.GET("/v1/health", s.healthHandler)
 
-	r.POST("/v1/movies", s.createMovieHandler)
-	r.GET("/v1/movies/:id", s.showMovieHandler)
-	r.PUT("/v1/movies/:id", s.updateMovieHandler)
-	r.DELETE("/v1/movies/:id", s.deleteMovieHandler)
-	r.GET("/v1/movies", s.listMoviesHandler)
+	movies := r.Group("/v1/movies", s.requireAuthenticatedUser())
+	movies.POST("", s.requirePermission("movies:write"), s.createMovieHandler)
+	movies.POST("/import", s.requirePermission("movies:write"), s.importMoviesHandler)
+	movies.GET("/:id", s.requirePermission("movies:read"), s.showMovieHandler)
+	movies.PUT("/:id", s.requirePermission("movies:write"), s.updateMovieHandler)
+	movies.PATCH("/:id", s.requirePermission("movies:write"), s.patchMovieHandler)
+	movies.DELETE("/:id", s.requirePermission("movies:write"), s.deleteMovieHandler)
+	movies.GET("", s.requirePermission("movies:read"), s.listMoviesHandler)
+	movies.GET("/export", s.requirePermission("movies:read"), s.exportMoviesHandler)
+	movies.GET("/trash", s.requirePermission("movies:write"), s.listTrashHandler)
+	movies.POST("/:id/restore", s.requirePermission("movies:write"), s.restoreMovieHandler)
+
+	// history routes
+	movies.GET("/:id/history", s.requirePermission("movies:read"), s.listMovieHistoryHandler)
+	movies.GET("/:id/history/:version", s.requirePermission("movies:read"), s.showMovieRevisionHandler)
+	movies.POST("/:id/revert", s.requirePermission("movies:write"), s.revertMovieHandler)
+
+	// reviews routes
+	movies.GET("/:id/reviews", s.requirePermission("movies:read"), s.listMovieReviewsHandler)
+	movies.POST("/:id/reviews", s.requirePermission("movies:read"), s.createMovieReviewHandler)
+	movies.GET("/:id/reviews/:review_id", s.requirePermission("movies:read"), s.showMovieReviewHandler)
+	movies.PUT("/:id/reviews/:review_id", s.requirePermission("movies:read"), s.updateMovieReviewHandler)
+	movies.DELETE("/:id/reviews/:review_id", s.requirePermission("movies:read"), s.deleteMovieReviewHandler)
+
+	// credits routes
+	movies.GET("/:id/credits", s.requirePermission("movies:read"), s.listMovieCreditsHandler)
+	movies.POST("/:id/credits", s.requirePermission("movies:write"), s.createMovieCreditHandler)
+	movies.DELETE("/:id/credits/:credit_id", s.requirePermission("movies:write"), s.deleteMovieCreditHandler)
+
+	// people routes
+	people := r.Group("/v1/people", s.requireAuthenticatedUser())
+	people.GET("", s.requirePermission("movies:read"), s.listPeopleHandler)
+	people.POST("", s.requirePermission("movies:write"), s.createPersonHandler)
+	people.GET("/:id", s.requirePermission("movies:read"), s.showPersonHandler)
+	people.PUT("/:id", s.requirePermission("movies:write"), s.updatePersonHandler)
+	people.DELETE("/:id", s.requirePermission("movies:write"), s.deletePersonHandler)
+
+	// collections routes
+	collections := r.Group("/v1/collections", s.requirePermission("movies:read"))
+	collections.GET("", s.listCollectionsHandler)
+	collections.POST("", s.createCollectionHandler)
+	collections.GET("/:id", s.showCollectionHandler)
+	collections.PUT("/:id", s.updateCollectionHandler)
+	collections.DELETE("/:id", s.deleteCollectionHandler)
+	collections.POST("/:id/items", s.addCollectionItemsHandler)
+	collections.DELETE("/:id/items", s.removeCollectionItemsHandler)
+	collections.PUT("/:id/items/order", s.reorderCollectionItemsHandler)
+
+	watchlist := r.Group("/v1/users/me/watchlist", s.requirePermission("movies:read"))
+	watchlist.GET("", s.showWatchlistHandler)
+	watchlist.POST("/items", s.addWatchlistItemsHandler)
+	watchlist.DELETE("/items", s.removeWatchlistItemsHandler)
+	watchlist.PUT("/items/order", s.reorderWatchlistItemsHandler)
 
 	// users routes
 	r.POST("/v1/users", s.registerUserHandler)
+	r.PUT("/v1/users/activated", s.activateUserHandler)
+	r.PUT("/v1/users/password", s.updateUserPasswordHandler)
+
+	// tokens routes
+	r.POST("/v1/tokens/authentication", s.createAuthenticationTokenHandler)
+	r.POST("/v1/tokens/password-reset", s.createPasswordResetTokenHandler)
 
 	return r
 }
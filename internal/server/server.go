@@ -2,16 +2,20 @@ package server
 
 import (
 	"context"
+	"crypto/rand"
 	"errors"
 	"flag"
 	"fmt"
 	"gin-project/internal/data"
 	logger "gin-project/internal/log"
+	"gin-project/internal/mailer"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
+	"sync"
 	"syscall"
 	"time"
 
@@ -30,85 +34,202 @@ type config struct {
 		burst   int
 		enabled bool
 	}
+	smtp struct {
+		host     string
+		port     int
+		username string
+		password string
+		sender   string
+		dropDir  string
+	}
+	cursor struct {
+		secret string
+	}
+	trash struct {
+		retention     time.Duration
+		purgeInterval time.Duration
+	}
+	log struct {
+		level  logger.Level
+		trace  logger.TracePolicy
+		stdout bool
+		stderr string
+		buffer int
+		file   struct {
+			path       string
+			maxSize    int64
+			interval   time.Duration
+			maxBackups int
+			maxAge     time.Duration
+			compress   bool
+		}
+	}
 }
 
 type Server struct {
-	config     config
-	models     data.Models
-	infoLog    *logger.Logger
-	errorLog   *logger.Logger
-	warningLog *logger.Logger
-	fatalLog   *logger.Logger
-	db         database.Service
+	config config
+	models data.Models
+	logger *logger.Logger
+	// logBuffer is set when the log entries are written asynchronously
+	logBuffer *logger.AsyncWriter
+	db        database.Service
+	mailer    mailer.Mailer
+	wg        sync.WaitGroup
 }
 
-var (
-	InfoLog    = logger.New(os.Stdout, logger.LevelInfo)
-	WarningLog = logger.New(os.Stdout, logger.LevelWarn)
-	ErrorLog   = logger.New(os.Stderr, logger.LevelError)
-	FatalLog   = logger.New(os.Stderr, logger.LevelFatal)
-)
-
-func NewServer() error {
+// NewServer configure the server from the flags and serve until it is shut
+// down. The log outputs are closed before it returns, the error is left for the
+// caller to report.
+func NewServer() (err error) {
 
 	var cfg config
 	port, _ := strconv.ParseInt(os.Getenv("PORT"), 10, 64)
 	flag.IntVar(&cfg.port, "port", int(port), "API server port")
 	flag.StringVar(&cfg.env, "env", os.Getenv("APP_ENV"), "Environment (development|staging|production)")
 
+	flag.StringVar(&cfg.cursor.secret, "cursor-secret", os.Getenv("CURSOR_SECRET"), "Key signing pagination cursors, a random key is used when empty")
+
 	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
 	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
 	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
+
+	smtpPort, _ := strconv.ParseInt(os.Getenv("SMTP_PORT"), 10, 64)
+	flag.StringVar(&cfg.smtp.host, "smtp-host", os.Getenv("SMTP_HOST"), "SMTP host, emails are written to smtp-drop-dir when empty")
+	flag.IntVar(&cfg.smtp.port, "smtp-port", int(smtpPort), "SMTP port")
+	flag.StringVar(&cfg.smtp.username, "smtp-username", os.Getenv("SMTP_USERNAME"), "SMTP username")
+	flag.StringVar(&cfg.smtp.password, "smtp-password", os.Getenv("SMTP_PASSWORD"), "SMTP password")
+	flag.StringVar(&cfg.smtp.sender, "smtp-sender", "Movies <no-reply@movies.local>", "SMTP sender")
+	flag.StringVar(&cfg.smtp.dropDir, "smtp-drop-dir", "tmp/mail", "Directory receiving emails when no SMTP host is configured")
+
+	flag.DurationVar(&cfg.trash.retention, "trash-retention", 30*24*time.Hour, "How long deleted movies stay in the trash, 0 disables the purge")
+	flag.DurationVar(&cfg.trash.purgeInterval, "trash-purge-interval", time.Hour, "Interval between two purges of the trash")
+
+	flag.TextVar(&cfg.log.level, "log-level", logger.LevelInfo, "Minimum log level (debug|info|warn|error|fatal), SIGUSR1 toggles debug logging")
+	flag.TextVar(&cfg.log.trace, "log-trace", logger.TraceError, "Entries carrying a stack trace (error|fatal|never)")
+	flag.BoolVar(&cfg.log.stdout, "log-stdout", true, "Write the log entries to stdout")
+	flag.StringVar(&cfg.log.stderr, "log-stderr", "", "Also write the log entries at or above this level to stderr (debug|info|warn|error|fatal), empty disables")
+	flag.IntVar(&cfg.log.buffer, "log-buffer", 0, "Number of log entries buffered for an asynchronous write, entries are dropped when the buffer is full, 0 writes synchronously")
+	flag.StringVar(&cfg.log.file.path, "log-file", "", "Also write the log entries to this file, empty disables")
+	flag.Int64Var(&cfg.log.file.maxSize, "log-file-max-size", 100, "Size in megabytes at which the log file is rotated, 0 disables")
+	flag.DurationVar(&cfg.log.file.interval, "log-file-interval", 24*time.Hour, "Interval at which the log file is rotated, 0 disables")
+	flag.IntVar(&cfg.log.file.maxBackups, "log-file-max-backups", 0, "Number of rotated log files kept, 0 keeps them all")
+	flag.DurationVar(&cfg.log.file.maxAge, "log-file-max-age", 7*24*time.Hour, "How long rotated log files are kept, 0 keeps them")
+	flag.BoolVar(&cfg.log.file.compress, "log-file-compress", true, "Gzip the rotated log files")
 	flag.Parse()
 
+	logOut, logBuffer, closeLog, err := openLogOutput(cfg)
+	if err != nil {
+		return err
+	}
+	// every goroutine logging through serverLogger is stopped by the deferred
+	// calls below before its outputs are closed
+	defer func() {
+		closeErr := closeLog()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+	serverLogger := logger.NewWithOptions(logOut, cfg.log.level, logger.Options{Trace: cfg.log.trace})
+
+	if cfg.cursor.secret == "" {
+		secret := make([]byte, 32)
+		_, err = rand.Read(secret)
+		if err != nil {
+			return err
+		}
+		cfg.cursor.secret = string(secret)
+	}
+
+	var mail mailer.Mailer
+	if cfg.smtp.host != "" {
+		mail = mailer.NewSMTP(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender)
+	} else {
+		fileMailer, err := mailer.NewFile(cfg.smtp.dropDir, cfg.smtp.sender)
+		if err != nil {
+			return err
+		}
+		mail = fileMailer
+	}
+
 	db := database.New()
 	defer db.Close()
 	NewServer := &Server{
-		config:     cfg,
-		infoLog:    InfoLog,
-		errorLog:   ErrorLog,
-		warningLog: WarningLog,
-		fatalLog:   FatalLog,
-		models:     data.NewModels(&db),
-		db:         db,
+		config:    cfg,
+		logger:    serverLogger,
+		logBuffer: logBuffer,
+		models:    data.NewModels(&db),
+		db:        db,
+		mailer:    mail,
 	}
 
 	// Declare Server config
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":%d", cfg.port),
 		Handler:      NewServer.RegisterRoutes(),
-		ErrorLog:     log.New(InfoLog, "", 0),
+		ErrorLog:     log.New(serverLogger, "", 0),
 		IdleTimeout:  time.Minute,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
 	}
 
-	shutdownError := make(chan error)
+	purge := make(chan struct{})
+	NewServer.startTrashPurge(purge)
+	stopPurge := sync.OnceFunc(func() { close(purge) })
 
+	// SIGUSR1 switch between debug logging and the configured level
+	toggleDebug := make(chan os.Signal, 1)
+	toggleDone := make(chan struct{})
+	signal.Notify(toggleDebug, syscall.SIGUSR1)
 	go func() {
-		quit := make(chan os.Signal, 1)
+		defer close(toggleDone)
+		for range toggleDebug {
+			level := logger.LevelDebug
+			if serverLogger.MinLevel() == logger.LevelDebug {
+				level = cfg.log.level
+			}
+			serverLogger.SetLevel(level)
+			serverLogger.Info("changed log level", "level", level)
+		}
+	}()
+	defer func() {
+		signal.Stop(toggleDebug)
+		close(toggleDebug)
+		<-toggleDone
+	}()
+
+	shutdownError := make(chan error)
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	// a server which fails to start leaves the shutdown goroutine waiting for
+	// a signal which is never delivered
+	defer signal.Stop(quit)
 
-		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
 		s := <-quit
 
-		InfoLog.PrintInfo("shutting down server", map[string]string{
-			"signal": s.String(),
-		})
+		serverLogger.Info("shutting down server", "signal", s.String())
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
-		shutdownError <- server.Shutdown(ctx)
+		err := server.Shutdown(ctx)
+		stopPurge()
+		if err != nil {
+			shutdownError <- err
+			return
+		}
 
-		os.Exit(0)
+		// wait for background tasks such as sending emails to complete
+		serverLogger.Info("completing background tasks", "addr", server.Addr)
+		NewServer.wg.Wait()
+		shutdownError <- nil
 	}()
 
-	InfoLog.PrintInfo("starting server", map[string]string{
-		"addr": server.Addr,
-		"env":  cfg.env,
-	})
+	serverLogger.Info("starting server", "addr", server.Addr, "env", cfg.env)
 
-	err := server.ListenAndServe()
+	err = server.ListenAndServe()
 	if !errors.Is(err, http.ErrServerClosed) {
+		stopPurge()
+		NewServer.wg.Wait()
 		return err
 	}
 
@@ -117,9 +238,62 @@ func NewServer() error {
 		return err
 	}
 
-	InfoLog.PrintInfo("stopped server", map[string]string{
-		"addr": server.Addr,
-	})
+	serverLogger.Info("stopped server", "addr", server.Addr)
 
 	return nil
 }
+
+// openLogOutput build the writer behind the server logger from the log flags,
+// the returned function flushes and closes it
+func openLogOutput(cfg config) (io.Writer, *logger.AsyncWriter, func() error, error) {
+	var outputs []logger.Output
+	var closers []io.Closer
+
+	if cfg.log.stdout {
+		outputs = append(outputs, logger.Output{Writer: os.Stdout, MinLevel: logger.LevelDebug})
+	}
+	if cfg.log.stderr != "" {
+		var level logger.Level
+		err := level.UnmarshalText([]byte(cfg.log.stderr))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		outputs = append(outputs, logger.Output{Writer: os.Stderr, MinLevel: level})
+	}
+	if cfg.log.file.path != "" {
+		file, err := logger.OpenRotatingFile(cfg.log.file.path, logger.RotateOptions{
+			MaxSize:    cfg.log.file.maxSize * 1024 * 1024,
+			Interval:   cfg.log.file.interval,
+			MaxBackups: cfg.log.file.maxBackups,
+			MaxAge:     cfg.log.file.maxAge,
+			Compress:   cfg.log.file.compress,
+		})
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		outputs = append(outputs, logger.Output{Writer: file, MinLevel: logger.LevelDebug})
+		closers = append(closers, file)
+	}
+
+	var out io.Writer = logger.NewMultiWriter(outputs...)
+	var buffer *logger.AsyncWriter
+	if cfg.log.buffer > 0 {
+		buffer = logger.NewAsyncWriter(out, cfg.log.buffer)
+		out = buffer
+		// the buffer is flushed before the outputs are closed
+		closers = append([]io.Closer{buffer}, closers...)
+	}
+
+	// the outputs cannot log about themselves, their errors are returned
+	closeLog := func() error {
+		var errs []error
+		for _, c := range closers {
+			err := c.Close()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("closing log output: %w", err))
+			}
+		}
+		return errors.Join(errs...)
+	}
+	return out, buffer, closeLog, nil
+}
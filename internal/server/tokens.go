@@ -0,0 +1,109 @@
+package server
+
+import (
+	"errors"
+	"gin-project/internal/data"
+	"gin-project/internal/validator"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+func (s *Server) createAuthenticationTokenHandler(c *gin.Context) {
+	var input struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	err := c.ShouldBindJSON(&input)
+	if err != nil {
+		s.errorResponse(c, errInvalidBody(err))
+		return
+	}
+
+	v := validator.New()
+	data.ValidateEmail(v, input.Email)
+	data.ValidatePasswordPlaintext(v, input.Password)
+	if !v.Valid() {
+		s.errorResponse(c, errFailedValidation(v.Errors))
+		return
+	}
+
+	user, err := s.models.Users.GetByEmail(c.Request.Context(), input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			s.errorResponse(c, errInvalidCredentials())
+		default:
+			s.errorResponse(c, err)
+		}
+		return
+	}
+
+	match, err := user.Password.Matches(input.Password)
+	if err != nil {
+		s.errorResponse(c, err)
+		return
+	}
+	if !match {
+		s.errorResponse(c, errInvalidCredentials())
+		return
+	}
+
+	token, err := s.models.Tokens.New(c.Request.Context(), user.ID, 24*time.Hour, data.ScopeAuthentication)
+	if err != nil {
+		s.errorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"authentication_token": token})
+}
+
+func (s *Server) createPasswordResetTokenHandler(c *gin.Context) {
+	var input struct {
+		Email string `json:"email"`
+	}
+	err := c.ShouldBindJSON(&input)
+	if err != nil {
+		s.errorResponse(c, errInvalidBody(err))
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		s.errorResponse(c, errFailedValidation(v.Errors))
+		return
+	}
+
+	// the response is the same whether the email exists or not, so that the
+	// endpoint cannot be used to enumerate accounts
+	response := gin.H{"message": "an email will be sent to you containing password reset instructions"}
+
+	user, err := s.models.Users.GetByEmail(c.Request.Context(), input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			c.JSON(http.StatusAccepted, response)
+		default:
+			s.errorResponse(c, err)
+		}
+		return
+	}
+
+	token, err := s.models.Tokens.New(c.Request.Context(), user.ID, 45*time.Minute, data.ScopePasswordReset)
+	if err != nil {
+		s.errorResponse(c, err)
+		return
+	}
+
+	s.background(func() {
+		mailData := map[string]any{
+			"passwordResetToken": token.Plaintext,
+		}
+		err := s.mailer.Send(user.Email, "token_password_reset.tmpl", mailData)
+		if err != nil {
+			s.logger.Error(err, "template", "token_password_reset.tmpl")
+		}
+	})
+
+	c.JSON(http.StatusAccepted, response)
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"gin-project/internal/data"
+	"gin-project/internal/validator"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+func (s *Server) listTrashHandler(c *gin.Context) {
+	filters := data.NewFilters()
+	filters.Sort = "-deleted_at"
+	filters.SortSafelist = []string{"-deleted_at"}
+	err := c.ShouldBindQuery(&filters)
+	if err != nil {
+		s.errorResponse(c, errInvalidQuery(err))
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		s.errorResponse(c, errFailedValidation(v.Errors))
+		return
+	}
+
+	movies, metadata, err := s.models.Movies.ListTrash(c.Request.Context(), filters)
+	if err != nil {
+		s.errorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"movies": movies, "metadata": metadata})
+}
+
+func (s *Server) restoreMovieHandler(c *gin.Context) {
+	id, ok := s.readUUIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	movie, err := s.models.Movies.Restore(c.Request.Context(), id.String(), s.contextGetUser(c).ID)
+	if err != nil {
+		s.errorResponse(c, err)
+		return
+	}
+
+	c.Header("ETag", versionETag(movie.Version))
+	c.JSON(http.StatusOK, movie)
+}
+
+// startTrashPurge periodically remove the movies that stayed in the trash
+// longer than the configured retention, until stop is closed
+func (s *Server) startTrashPurge(stop <-chan struct{}) {
+	if s.config.trash.retention <= 0 || s.config.trash.purgeInterval <= 0 {
+		return
+	}
+
+	s.background(func() {
+		ticker := time.NewTicker(s.config.trash.purgeInterval)
+		defer ticker.Stop()
+
+		for {
+			purged, err := s.models.Movies.Purge(context.Background(), s.config.trash.retention)
+			if err != nil {
+				s.logger.Error(err)
+			} else if purged > 0 {
+				s.logger.Info("purged movies from the trash", "count", purged)
+			}
+
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+}
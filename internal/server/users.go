@@ -6,6 +6,7 @@ import (
 	"gin-project/internal/validator"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"time"
 )
 
 func (s *Server) registerUserHandler(c *gin.Context) {
@@ -17,8 +18,7 @@ func (s *Server) registerUserHandler(c *gin.Context) {
 	}
 	err := c.ShouldBindJSON(&input)
 	if err != nil {
-		s.errorResponse(c, http.StatusBadRequest, err.Error())
-		s.errorLog.PrintError(err, nil)
+		s.errorResponse(c, errInvalidBody(err))
 		return
 	}
 	user := data.User{
@@ -29,14 +29,13 @@ func (s *Server) registerUserHandler(c *gin.Context) {
 
 	err = user.Password.Set(input.Password)
 	if err != nil {
-		s.errorResponse(c, http.StatusInternalServerError, err.Error())
-		s.errorLog.PrintError(err, nil)
+		s.errorResponse(c, err)
 		return
 	}
 
 	v := validator.New()
 	if data.ValidateUser(v, &user); !v.Valid() {
-		s.errorResponse(c, http.StatusBadRequest, v.Errors)
+		s.errorResponse(c, errFailedValidation(v.Errors))
 		return
 	}
 
@@ -45,12 +44,134 @@ func (s *Server) registerUserHandler(c *gin.Context) {
 		switch {
 		case errors.Is(err, data.ErrDuplicateEmail):
 			v.AddError("email", "a user with this email already exists")
-			s.errorResponse(c, http.StatusConflict, v.Errors)
+			s.errorResponse(c, errDuplicate(v.Errors))
 		default:
-			s.serverErrorResponse(c, err)
+			s.errorResponse(c, err)
 		}
 		return
 	}
 
+	err = s.models.Permissions.AddForUser(c.Request.Context(), user.ID, "movies:read")
+	if err != nil {
+		s.errorResponse(c, err)
+		return
+	}
+
+	token, err := s.models.Tokens.New(c.Request.Context(), user.ID, 3*24*time.Hour, data.ScopeActivation)
+	if err != nil {
+		s.errorResponse(c, err)
+		return
+	}
+
+	s.background(func() {
+		mailData := map[string]any{
+			"activationToken": token.Plaintext,
+			"userID":          user.ID,
+			"username":        user.Username,
+		}
+		err := s.mailer.Send(user.Email, "user_welcome.tmpl", mailData)
+		if err != nil {
+			s.logger.Error(err, "template", "user_welcome.tmpl")
+		}
+	})
+
 	c.JSON(http.StatusCreated, gin.H{"user": user})
 }
+
+func (s *Server) activateUserHandler(c *gin.Context) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+	err := c.ShouldBindJSON(&input)
+	if err != nil {
+		s.errorResponse(c, errInvalidBody(err))
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		s.errorResponse(c, errFailedValidation(v.Errors))
+		return
+	}
+
+	user, err := s.models.Users.GetForToken(c.Request.Context(), data.ScopeActivation, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired activation token")
+			s.errorResponse(c, errFailedValidation(v.Errors))
+		default:
+			s.errorResponse(c, err)
+		}
+		return
+	}
+
+	user.Activated = true
+
+	err = s.models.Users.Update(c.Request.Context(), user)
+	if err != nil {
+		s.errorResponse(c, err)
+		return
+	}
+
+	err = s.models.Tokens.DeleteAllForUser(c.Request.Context(), data.ScopeActivation, user.ID)
+	if err != nil {
+		s.errorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user})
+}
+
+func (s *Server) updateUserPasswordHandler(c *gin.Context) {
+	var input struct {
+		Password       string `json:"password"`
+		TokenPlaintext string `json:"token"`
+	}
+	err := c.ShouldBindJSON(&input)
+	if err != nil {
+		s.errorResponse(c, errInvalidBody(err))
+		return
+	}
+
+	v := validator.New()
+	data.ValidatePasswordPlaintext(v, input.Password)
+	data.ValidateTokenPlaintext(v, input.TokenPlaintext)
+	if !v.Valid() {
+		s.errorResponse(c, errFailedValidation(v.Errors))
+		return
+	}
+
+	user, err := s.models.Users.GetForToken(c.Request.Context(), data.ScopePasswordReset, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired password reset token")
+			s.errorResponse(c, errFailedValidation(v.Errors))
+		default:
+			s.errorResponse(c, err)
+		}
+		return
+	}
+
+	err = user.Password.Set(input.Password)
+	if err != nil {
+		s.errorResponse(c, err)
+		return
+	}
+
+	err = s.models.Users.Update(c.Request.Context(), user)
+	if err != nil {
+		s.errorResponse(c, err)
+		return
+	}
+
+	// the reset token is single use, and sessions opened with the old password are revoked
+	err = s.models.Tokens.DeleteAllScopesForUser(c.Request.Context(), user.ID)
+	if err != nil {
+		s.errorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "your password was successfully reset"})
+}
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS collections (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+    name text NOT NULL,
+    description text NOT NULL DEFAULT '',
+    public bool NOT NULL DEFAULT false,
+    watchlist bool NOT NULL DEFAULT false,
+    version integer NOT NULL DEFAULT 1
+);
+
+-- every user has at most one watchlist
+CREATE UNIQUE INDEX IF NOT EXISTS collections_watchlist_idx ON collections (user_id) WHERE watchlist;
+
+CREATE TABLE IF NOT EXISTS collection_items (
+    collection_id UUID NOT NULL REFERENCES collections ON DELETE CASCADE,
+    movie_id UUID NOT NULL REFERENCES movies ON DELETE CASCADE,
+    position integer NOT NULL,
+    added_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (collection_id, movie_id)
+);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS movie_revisions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    -- no foreign key, the revisions are an audit trail which outlives the
+    -- movies purged from the trash
+    movie_id UUID NOT NULL,
+    version integer NOT NULL,
+    operation text NOT NULL CHECK (operation IN ('insert', 'update', 'delete', 'restore')),
+    before jsonb,
+    after jsonb,
+    user_id UUID REFERENCES users ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS movie_revisions_movie_id_idx ON movie_revisions (movie_id, created_at);